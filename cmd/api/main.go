@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -12,6 +13,21 @@ import (
 	"rinha-backend-2025/internal/server"
 )
 
+// reloadOnHangup re-reads .env and applies the runtime tunables each time
+// the process gets SIGHUP.
+func reloadOnHangup(appServer *server.Server) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := appServer.Reload(); err != nil {
+			slog.Error("failed to reload configuration", "error", err)
+			continue
+		}
+		slog.Info("configuration reloaded")
+	}
+}
+
 func gracefulShutdown(apiServer *http.Server, appServer *server.Server, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -20,21 +36,22 @@ func gracefulShutdown(apiServer *http.Server, appServer *server.Server, done cha
 	// Listen for the interrupt signal.
 	<-ctx.Done()
 
-	log.Println("shutting down gracefully, press Ctrl+C again to force")
+	slog.Info("shutting down gracefully, press Ctrl+C again to force")
 	stop() // Allow Ctrl+C to force shutdown
 
-	// Stop worker pool first
-	appServer.Shutdown()
-
 	// The context is used to inform the server it has 5 seconds to finish
 	// the request it is currently handling
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown with error: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exiting")
+	// Stop the worker pool and flush pending inserts once no request can
+	// enqueue more work
+	appServer.Shutdown()
+
+	slog.Info("server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
 	done <- true
@@ -44,11 +61,17 @@ func main() {
 
 	httpServer, appServer := server.NewServer()
 
+	// Warm up connections before accepting traffic
+	warmUpCtx, cancelWarmUp := context.WithTimeout(context.Background(), 10*time.Second)
+	appServer.WarmUp(warmUpCtx)
+	cancelWarmUp()
+
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
 	// Run graceful shutdown in a separate goroutine
 	go gracefulShutdown(httpServer, appServer, done)
+	go reloadOnHangup(appServer)
 
 	err := httpServer.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
@@ -57,5 +80,5 @@ func main() {
 
 	// Wait for the graceful shutdown to complete
 	<-done
-	log.Println("Graceful shutdown complete.")
+	slog.Info("graceful shutdown complete")
 }
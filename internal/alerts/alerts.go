@@ -0,0 +1,143 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	webhookTimeout = 5 * time.Second
+	// webhookQueueSize and webhookSenders bound the alerts in flight, e.g.
+	// when a processor outage fails payments by the thousand
+	webhookQueueSize = 256
+	webhookSenders   = 2
+)
+
+// PaymentFailure describes a payment that was given up on and marked failed.
+type PaymentFailure struct {
+	PaymentID     uuid.UUID    `json:"paymentId"`
+	CorrelationID uuid.UUID    `json:"correlationId"`
+	Amount        models.Money `json:"amount"`
+	TenantID      *string      `json:"tenantId,omitempty"`
+	Reason        string       `json:"reason"`
+	FailedAt      time.Time    `json:"failedAt"`
+}
+
+// Sink is notified whenever a payment permanently fails. Implementations must
+// not block the caller for long; they run on the worker goroutines.
+type Sink interface {
+	PaymentFailed(failure PaymentFailure)
+}
+
+// FromEnv returns the sink selected by ALERT_SINK: "log" (the default),
+// "webhook" (posts to ALERT_WEBHOOK_URL) or "none".
+func FromEnv() Sink {
+	switch strings.ToLower(os.Getenv("ALERT_SINK")) {
+	case "", "log":
+		return LogSink{}
+	case "none":
+		return nopSink{}
+	case "webhook":
+		url := os.Getenv("ALERT_WEBHOOK_URL")
+		if url == "" {
+			slog.Warn("ALERT_SINK=webhook without ALERT_WEBHOOK_URL, logging alerts instead")
+			return LogSink{}
+		}
+		return NewWebhookSink(url)
+	default:
+		slog.Warn("unknown ALERT_SINK, logging alerts instead", "sink", os.Getenv("ALERT_SINK"))
+		return LogSink{}
+	}
+}
+
+// LogSink writes each failure as an error-level log line.
+type LogSink struct{}
+
+func (LogSink) PaymentFailed(f PaymentFailure) {
+	slog.Error("payment permanently failed", "paymentId", f.PaymentID, "correlationId", f.CorrelationID, "amount", f.Amount, "reason", f.Reason)
+}
+
+type nopSink struct{}
+
+func (nopSink) PaymentFailed(PaymentFailure) {}
+
+// WebhookSink POSTs each failure as JSON to a URL. Delivery is asynchronous
+// and best effort: a few senders drain a bounded queue, alerts arriving
+// while it is full are dropped and counted, and failed deliveries are logged
+// and the failure with them.
+type WebhookSink struct {
+	url     string
+	client  *http.Client
+	queue   chan PaymentFailure
+	dropped atomic.Uint64
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	w := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan PaymentFailure, webhookQueueSize),
+	}
+	for i := 0; i < webhookSenders; i++ {
+		go w.send()
+	}
+	return w
+}
+
+// PaymentFailed queues the alert. It never blocks.
+func (w *WebhookSink) PaymentFailed(f PaymentFailure) {
+	select {
+	case w.queue <- f:
+	default:
+		dropped := w.dropped.Add(1)
+		slog.Warn("alert queue full, dropping payment failure alert", "paymentId", f.PaymentID, "correlationId", f.CorrelationID, "dropped", dropped)
+	}
+}
+
+// Dropped returns how many alerts were dropped because the queue was full.
+func (w *WebhookSink) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+func (w *WebhookSink) send() {
+	for f := range w.queue {
+		if err := w.post(f); err != nil {
+			slog.Error("failed to deliver payment failure alert", "paymentId", f.PaymentID, "correlationId", f.CorrelationID, "reason", f.Reason, "error", err)
+		}
+	}
+}
+
+func (w *WebhookSink) post(f PaymentFailure) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookSinkPostsFailure(t *testing.T) {
+	received := make(chan PaymentFailure, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var f PaymentFailure
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			t.Errorf("error decoding alert: %v", err)
+		}
+		received <- f
+	}))
+	defer srv.Close()
+
+	failure := PaymentFailure{PaymentID: uuid.New(), CorrelationID: uuid.New(), Amount: 1990, Reason: "all payment processors failed"}
+	NewWebhookSink(srv.URL).PaymentFailed(failure)
+
+	select {
+	case got := <-received:
+		if got.PaymentID != failure.PaymentID || got.Amount != failure.Amount || got.Reason != failure.Reason {
+			t.Errorf("unexpected alert: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestWebhookSinkDropsWhenQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	sink := NewWebhookSink(srv.URL)
+	// The senders hold one alert each and the rest fill the queue
+	for i := 0; i < webhookSenders+webhookQueueSize+10; i++ {
+		sink.PaymentFailed(PaymentFailure{PaymentID: uuid.New()})
+	}
+
+	if dropped := sink.Dropped(); dropped < 10 {
+		t.Errorf("expected at least 10 alerts dropped, got %d", dropped)
+	}
+}
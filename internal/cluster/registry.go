@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	heartbeatInterval = 2 * time.Second
+	staleAfter        = 10 * time.Second
+	registerRetry     = 500 * time.Millisecond
+)
+
+// ResubmitFunc hands a reclaimed payment to the local worker pool. It must
+// not block: it runs on the heartbeat goroutine, and payments it refuses are
+// offered again on the next tick.
+type ResubmitFunc func(payment models.Payment) error
+
+// Registry registers this instance in the shared database, keeps its
+// heartbeat alive and reclaims the unfinished payments of peers whose
+// heartbeat lapsed.
+type Registry struct {
+	id       string
+	db       database.Service
+	resubmit ResubmitFunc
+	// backlog holds reclaimed payments the pool had no room for. They stay
+	// owned and pending, so peers reclaim them if this instance dies.
+	backlog []models.Payment
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+func NewRegistry(db database.Service, resubmit ResubmitFunc) *Registry {
+	return &Registry{
+		id:       newInstanceID(),
+		db:       db,
+		resubmit: resubmit,
+	}
+}
+
+// newInstanceID uses INSTANCE_ID when set, otherwise the hostname plus a
+// random suffix so a restarted container never inherits its old identity.
+func newInstanceID() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "instance"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return hostname
+	}
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+func (r *Registry) ID() string {
+	return r.id
+}
+
+// Start registers the instance, retrying until ctx is done, and takes back
+// the unfinished payments a previous run under the same ID left behind. An
+// error means the instance is not registered: payments stamped with its ID
+// could never be reclaimed, so the caller should not serve traffic.
+func (r *Registry) Start(ctx context.Context) error {
+	for {
+		err := r.db.RegisterInstance(ctx, r.id)
+		if err == nil {
+			break
+		}
+		slog.Warn("failed to register instance, retrying", "instanceId", r.id, "error", err)
+		select {
+		case <-time.After(registerRetry):
+		case <-ctx.Done():
+			return err
+		}
+	}
+
+	own, err := r.db.ReclaimOwnPayments(ctx, r.id)
+	if err != nil {
+		slog.Error("failed to reclaim payments left by a previous run", "instanceId", r.id, "error", err)
+	} else if len(own) > 0 {
+		slog.Info("reclaimed payments left by a previous run", "instanceId", r.id, "payments", len(own))
+		r.backlog = own
+		r.resubmitBacklog()
+	}
+
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go r.run(ctx)
+
+	slog.Info("registered instance", "instanceId", r.id)
+	return nil
+}
+
+func (r *Registry) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.db.ExpireInstance(ctx, r.id); err != nil {
+		slog.Error("failed to expire instance", "instanceId", r.id, "error", err)
+	}
+}
+
+func (r *Registry) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.tick(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Registry) tick(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, heartbeatInterval)
+	defer cancel()
+
+	if err := r.db.HeartbeatInstance(ctx, r.id); err != nil {
+		slog.Error("failed to heartbeat instance", "instanceId", r.id, "error", err)
+		return
+	}
+
+	// Don't take over more while earlier payments still wait for room
+	if r.resubmitBacklog() > 0 {
+		return
+	}
+
+	payments, err := r.db.ReclaimPayments(ctx, time.Now().Add(-staleAfter), r.id)
+	if err != nil {
+		slog.Error("failed to reclaim payments from stale instances", "instanceId", r.id, "error", err)
+		return
+	}
+
+	if len(payments) == 0 {
+		return
+	}
+
+	slog.Info("reclaimed payments from stale peers", "instanceId", r.id, "payments", len(payments))
+	r.backlog = payments
+	r.resubmitBacklog()
+}
+
+// resubmitBacklog hands the backlog to the pool until it refuses one,
+// returning how many are left for the next tick.
+func (r *Registry) resubmitBacklog() int {
+	for i, payment := range r.backlog {
+		if err := r.resubmit(payment); err != nil {
+			slog.Warn("worker pool refused reclaimed payments, retrying next heartbeat", "remaining", len(r.backlog)-i, "error", err)
+			r.backlog = r.backlog[i:]
+			return len(r.backlog)
+		}
+	}
+	r.backlog = nil
+	return 0
+}
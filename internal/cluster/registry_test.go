@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+)
+
+type registryDB struct {
+	database.Service
+	registerFailures int
+	own              []models.Payment
+	reclaims         int
+}
+
+func (db *registryDB) RegisterInstance(context.Context, string) error {
+	if db.registerFailures > 0 {
+		db.registerFailures--
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (db *registryDB) HeartbeatInstance(context.Context, string) error {
+	return nil
+}
+
+func (db *registryDB) ReclaimOwnPayments(context.Context, string) ([]models.Payment, error) {
+	return db.own, nil
+}
+
+func (db *registryDB) ReclaimPayments(context.Context, time.Time, string) ([]models.Payment, error) {
+	db.reclaims++
+	return nil, nil
+}
+
+func (db *registryDB) ExpireInstance(context.Context, string) error {
+	return nil
+}
+
+func TestRegistryKeepsReclaimedPaymentsThePoolRefused(t *testing.T) {
+	db := &registryDB{registerFailures: 1}
+	for i := 0; i < 3; i++ {
+		db.own = append(db.own, models.Payment{ID: uuid.New(), Status: models.PaymentStatusPending})
+	}
+
+	room := 1
+	var submitted []uuid.UUID
+	r := NewRegistry(db, func(payment models.Payment) error {
+		if room == 0 {
+			return errors.New("queue full")
+		}
+		room--
+		submitted = append(submitted, payment.ID)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("expected registration to be retried, got %v", err)
+	}
+	r.Stop()
+
+	if len(submitted) != 1 || len(r.backlog) != 2 {
+		t.Fatalf("expected 1 payment submitted and 2 kept, got %d and %d", len(submitted), len(r.backlog))
+	}
+
+	// Nothing more is reclaimed until the backlog is through
+	r.tick(ctx)
+	if db.reclaims != 0 {
+		t.Fatalf("expected no reclaim while the backlog waits, got %d", db.reclaims)
+	}
+
+	room = 2
+	r.tick(ctx)
+	if len(submitted) != 3 || len(r.backlog) != 0 || db.reclaims != 1 {
+		t.Errorf("expected the backlog submitted and then a reclaim, got %d submitted, %d kept, %d reclaims", len(submitted), len(r.backlog), db.reclaims)
+	}
+}
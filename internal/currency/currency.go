@@ -0,0 +1,151 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rinha-backend-2025/internal/models"
+)
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// RateProvider returns how many units of the base currency one unit of the
+// given currency is worth.
+type RateProvider interface {
+	Rate(ctx context.Context, currency string) (float64, error)
+}
+
+// StaticRateProvider serves rates from a fixed table.
+type StaticRateProvider struct {
+	rates map[string]float64
+}
+
+func NewStaticRateProvider(rates map[string]float64) *StaticRateProvider {
+	normalized := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		normalized[Normalize(code)] = rate
+	}
+	return &StaticRateProvider{rates: normalized}
+}
+
+// ParseRates parses a "USD=5.10,EUR=5.60" style list into a rate table.
+func ParseRates(spec string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		code, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid exchange rate %q, expected CODE=RATE", pair)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %q", code, value)
+		}
+		rates[Normalize(code)] = rate
+	}
+	return rates, nil
+}
+
+func (p *StaticRateProvider) Rate(_ context.Context, currency string) (float64, error) {
+	rate, ok := p.rates[Normalize(currency)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	return rate, nil
+}
+
+type cachedRate struct {
+	rate      float64
+	expiresAt time.Time
+}
+
+// CachingRateProvider memoizes rates from another provider for a fixed TTL.
+type CachingRateProvider struct {
+	next    RateProvider
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cachedRate
+}
+
+func NewCachingRateProvider(next RateProvider, ttl time.Duration) *CachingRateProvider {
+	return &CachingRateProvider{
+		next:    next,
+		ttl:     ttl,
+		entries: make(map[string]cachedRate),
+	}
+}
+
+func (p *CachingRateProvider) Rate(ctx context.Context, currency string) (float64, error) {
+	code := Normalize(currency)
+
+	p.mu.RLock()
+	entry, ok := p.entries[code]
+	p.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.rate, nil
+	}
+
+	rate, err := p.next.Rate(ctx, code)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	p.entries[code] = cachedRate{rate: rate, expiresAt: time.Now().Add(p.ttl)}
+	p.mu.Unlock()
+
+	return rate, nil
+}
+
+// Converter normalizes amounts into the base currency, falling back to a
+// static rate table when the primary provider cannot answer.
+type Converter struct {
+	base     string
+	provider RateProvider
+	fallback RateProvider
+}
+
+func NewConverter(base string, provider, fallback RateProvider) *Converter {
+	return &Converter{
+		base:     Normalize(base),
+		provider: provider,
+		fallback: fallback,
+	}
+}
+
+func (c *Converter) Base() string {
+	return c.base
+}
+
+// ToBase converts amount from currency into the base currency, rounded to
+// cents. An empty currency is treated as the base currency.
+func (c *Converter) ToBase(ctx context.Context, amount models.Money, currency string) (models.Money, error) {
+	code := Normalize(currency)
+	if code == "" || code == c.base {
+		return amount, nil
+	}
+
+	rate, err := c.provider.Rate(ctx, code)
+	if err != nil && c.fallback != nil {
+		rate, err = c.fallback.Rate(ctx, code)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return amount.MulRate(rate), nil
+}
+
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,60 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseRates(t *testing.T) {
+	rates, err := ParseRates("usd=5.10, EUR=5.6")
+	if err != nil {
+		t.Fatalf("ParseRates() error = %v", err)
+	}
+	if rates["USD"] != 5.10 || rates["EUR"] != 5.6 {
+		t.Fatalf("unexpected rates: %v", rates)
+	}
+
+	if _, err := ParseRates("USD"); err == nil {
+		t.Fatal("expected error for missing rate")
+	}
+	if _, err := ParseRates("USD=-1"); err == nil {
+		t.Fatal("expected error for negative rate")
+	}
+}
+
+func TestConverterToBase(t *testing.T) {
+	static := NewStaticRateProvider(map[string]float64{"USD": 5.10})
+	converter := NewConverter("BRL", NewCachingRateProvider(static, 0), nil)
+
+	amount, err := converter.ToBase(context.Background(), 1990, "usd")
+	if err != nil {
+		t.Fatalf("ToBase() error = %v", err)
+	}
+	if amount != 10149 {
+		t.Errorf("expected 101.49, got %v", amount)
+	}
+
+	amount, err = converter.ToBase(context.Background(), 1990, "")
+	if err != nil || amount != 1990 {
+		t.Errorf("expected base currency passthrough, got %v, %v", amount, err)
+	}
+
+	if _, err := converter.ToBase(context.Background(), 1, "JPY"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("expected ErrUnsupportedCurrency, got %v", err)
+	}
+}
+
+func TestConverterFallsBackToStaticRates(t *testing.T) {
+	primary := NewStaticRateProvider(nil)
+	fallback := NewStaticRateProvider(map[string]float64{"EUR": 6})
+	converter := NewConverter("BRL", primary, fallback)
+
+	amount, err := converter.ToBase(context.Background(), 1000, "EUR")
+	if err != nil {
+		t.Fatalf("ToBase() error = %v", err)
+	}
+	if amount != 6000 {
+		t.Errorf("expected 60, got %v", amount)
+	}
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultBatchInterval = 2 * time.Millisecond
+	insertColumns        = 9
+)
+
+// errBatchWriterClosed is returned by inserts that arrive after Close.
+var errBatchWriterClosed = errors.New("database is closed")
+
+type insertRequest struct {
+	ctx     context.Context
+	payment *models.Payment
+	done    chan error
+}
+
+// batchWriter groups concurrent CreatePayment calls into multi-row INSERTs.
+// Callers still block until their row is written, so IDs and timestamps are
+// returned exactly as with a single-row insert, but N requests arriving
+// within the flush interval cost one round-trip instead of N.
+type batchWriter struct {
+	s        *service
+	requests chan insertRequest
+	maxBatch int
+	interval time.Duration
+	wg       sync.WaitGroup
+
+	// closeMutex keeps close from closing requests while an insert is
+	// sending on it
+	closeMutex sync.RWMutex
+	closed     bool
+}
+
+// newBatchWriterFromEnv reads DB_BATCH_SIZE and DB_BATCH_INTERVAL. A batch
+// size of 1 or less disables batching.
+func newBatchWriterFromEnv(s *service) *batchWriter {
+	size := defaultBatchSize
+	if v, err := strconv.Atoi(os.Getenv("DB_BATCH_SIZE")); err == nil {
+		size = v
+	}
+	if size <= 1 {
+		return nil
+	}
+
+	interval := defaultBatchInterval
+	if v, err := time.ParseDuration(os.Getenv("DB_BATCH_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	w := &batchWriter{
+		s:        s,
+		requests: make(chan insertRequest, size*4),
+		maxBatch: size,
+		interval: interval,
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *batchWriter) insert(ctx context.Context, payment *models.Payment) error {
+	req := insertRequest{ctx: ctx, payment: payment, done: make(chan error, 1)}
+
+	w.closeMutex.RLock()
+	if w.closed {
+		w.closeMutex.RUnlock()
+		return errBatchWriterClosed
+	}
+	select {
+	case w.requests <- req:
+	case <-ctx.Done():
+		w.closeMutex.RUnlock()
+		return ctx.Err()
+	}
+	w.closeMutex.RUnlock()
+
+	// Once queued the row may still be written, so wait for the outcome
+	// rather than report an error for a row that exists. flush skips
+	// requests whose context has ended, which bounds the wait.
+	return <-req.done
+}
+
+// close flushes whatever is buffered and stops the writer.
+func (w *batchWriter) close() {
+	w.closeMutex.Lock()
+	if w.closed {
+		w.closeMutex.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.requests)
+	w.closeMutex.Unlock()
+
+	w.wg.Wait()
+}
+
+func (w *batchWriter) run() {
+	defer w.wg.Done()
+
+	batch := make([]insertRequest, 0, w.maxBatch)
+	timer := time.NewTimer(w.interval)
+	timer.Stop()
+
+	for {
+		select {
+		case req, ok := <-w.requests:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(w.interval)
+			}
+			batch = append(batch, req)
+			if len(batch) >= w.maxBatch {
+				timer.Stop()
+				w.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-timer.C:
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (w *batchWriter) flush(batch []insertRequest) {
+	// Callers that gave up before the flush get their error and no row
+	live := batch[:0]
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.done <- err
+			continue
+		}
+		live = append(live, req)
+	}
+	batch = live
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := w.insertBatch(ctx, batch)
+	if err == nil {
+		return
+	}
+
+	// One bad row (e.g. a duplicate correlationId) fails the whole statement,
+	// so retry row by row to give each caller its own result.
+	slog.Debug("batch insert failed, falling back to single-row inserts", "rows", len(batch), "error", err)
+	for _, req := range batch {
+		req.done <- w.s.insertPayment(req.ctx, req.payment)
+	}
+}
+
+func (w *batchWriter) insertBatch(ctx context.Context, batch []insertRequest) error {
+	var query strings.Builder
+	query.WriteString(`INSERT INTO payments (correlation_id, amount, currency, original_amount, tenant_id, owner_instance, callback_url, status, requested_at) VALUES `)
+
+	args := make([]any, 0, len(batch)*insertColumns)
+	for i, req := range batch {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for col := 1; col <= insertColumns; col++ {
+			if col > 1 {
+				query.WriteString(", ")
+			}
+			query.WriteString("$" + strconv.Itoa(i*insertColumns+col))
+		}
+		query.WriteString(")")
+
+		p := req.payment
+		args = append(args, p.CorrelationID, p.Amount, p.Currency, p.OriginalAmount, p.TenantID, p.OwnerInstance, p.CallbackURL, p.Status, p.RequestedAt)
+	}
+	query.WriteString(` RETURNING id, correlation_id, requested_at, created_at, updated_at`)
+
+	rows, err := w.s.pool.Query(ctx, query.String(), args...)
+	if err != nil {
+		return fmt.Errorf("failed to insert payment batch: %w", err)
+	}
+	defer rows.Close()
+
+	byCorrelation := make(map[uuid.UUID]*models.Payment, len(batch))
+	for _, req := range batch {
+		byCorrelation[req.payment.CorrelationID] = req.payment
+	}
+
+	for rows.Next() {
+		var id, correlationID uuid.UUID
+		var requestedAt, createdAt, updatedAt time.Time
+		if err := rows.Scan(&id, &correlationID, &requestedAt, &createdAt, &updatedAt); err != nil {
+			return fmt.Errorf("failed to scan payment batch: %w", err)
+		}
+		if p, ok := byCorrelation[correlationID]; ok {
+			p.ID = id
+			p.RequestedAt = requestedAt
+			p.CreatedAt = createdAt
+			p.UpdatedAt = updatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate payment batch: %w", err)
+	}
+
+	for _, req := range batch {
+		req.done <- nil
+	}
+	return nil
+}
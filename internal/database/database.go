@@ -2,17 +2,20 @@ package database
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
+	"rinha-backend-2025/internal/logging"
 	"rinha-backend-2025/internal/models"
 )
 
@@ -26,24 +29,145 @@ type Service interface {
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
-	// CreatePayment creates a new payment record
+	// WarmUp opens and pings the given number of pooled connections so the
+	// first requests don't pay the connection setup cost.
+	WarmUp(ctx context.Context, connections int) error
+
+	// CreatePayment creates a new payment record, or returns
+	// ErrDuplicateCorrelationID if one with its correlationId exists
 	CreatePayment(ctx context.Context, payment *models.Payment) error
 	
-	// UpdatePaymentStatus updates the status of a payment
+	// GetPayment returns a payment by its ID, or ErrPaymentNotFound
+	GetPayment(ctx context.Context, paymentID uuid.UUID) (*models.Payment, error)
+	
+	// GetPaymentByCorrelationID returns a payment by its correlationId, or
+	// ErrPaymentNotFound
+	GetPaymentByCorrelationID(ctx context.Context, correlationID uuid.UUID) (*models.Payment, error)
+	
+	// UpdatePaymentStatus updates the status of a payment. Completed and
+	// cancelled payments are final: it returns ErrPaymentAlreadyCompleted or
+	// ErrPaymentCancelled instead of changing them
 	UpdatePaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus) error
 	
-	// CompletePayment updates payment with final processing details
-	CompletePayment(ctx context.Context, paymentID uuid.UUID, fee float64, processorType string) error
+	// TransitionPaymentStatus moves a payment to status only if its current
+	// status is one of from, reporting whether it did
+	TransitionPaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus, from ...models.PaymentStatus) (bool, error)
+	
+	// FailPayment marks a payment failed for reason, with the same final
+	// status errors as UpdatePaymentStatus
+	FailPayment(ctx context.Context, paymentID uuid.UUID, reason models.FailureReason) error
+	
+	// ExpirePayment fails a payment that is still pending as expired,
+	// reporting whether it did
+	ExpirePayment(ctx context.Context, paymentID uuid.UUID) (bool, error)
 	
-	// GetPaymentSummary returns payment summary grouped by processor type
-	GetPaymentSummary(ctx context.Context, startDate, endDate *time.Time) (models.PaymentSummaryResponse, error)
+	// CompletePayment updates payment with final processing details exactly
+	// once; later calls return ErrPaymentAlreadyCompleted
+	CompletePayment(ctx context.Context, paymentID uuid.UUID, fee models.Money, processorType string, latency time.Duration) error
+	
+	// CancelPayment cancels a pending payment, returning
+	// ErrPaymentNotCancellable once processing has started
+	CancelPayment(ctx context.Context, paymentID uuid.UUID) error
+	
+	// GetPaymentSummary returns payment summary grouped by processor type,
+	// optionally restricted to a single tenant
+	GetPaymentSummary(ctx context.Context, startDate, endDate *time.Time, tenantID *string) (models.PaymentSummaryResponse, error)
+	
+	// GetProcessorStats aggregates fees and processor latencies of the
+	// payments completed since the given time, keyed by processor
+	GetProcessorStats(ctx context.Context, since time.Time) (map[string]models.ProcessorStats, error)
 	
 	// ClearPayments removes all payments from the table (for testing)
 	ClearPayments(ctx context.Context) error
+	
+	// DeletePayment removes a payment no worker has started, with its
+	// history, returning ErrPaymentNotFound if there is no such payment
+	DeletePayment(ctx context.Context, paymentID uuid.UUID) error
+	
+	// RegisterInstance records a running instance and its first heartbeat
+	RegisterInstance(ctx context.Context, instanceID string) error
+	
+	// HeartbeatInstance refreshes the heartbeat of a registered instance
+	HeartbeatInstance(ctx context.Context, instanceID string) error
+	
+	// ExpireInstance marks an instance as gone on shutdown so peers reclaim
+	// its unfinished payments immediately
+	ExpireInstance(ctx context.Context, instanceID string) error
+	
+	// ReclaimPayments takes ownership of the unfinished payments of every
+	// instance whose heartbeat is older than staleBefore and returns them with
+	// the status they had before being reclaimed
+	ReclaimPayments(ctx context.Context, staleBefore time.Time, newOwner string) ([]models.Payment, error)
+	
+	// ReclaimOwnPayments moves the unfinished payments already owned by
+	// owner back to pending, e.g. left by a previous run with the same
+	// INSTANCE_ID, returning them with their previous status
+	ReclaimOwnPayments(ctx context.Context, owner string) ([]models.Payment, error)
+	
+	// RequeueFailedPayments moves failed payments back to pending under owner
+	// so they can be submitted again. A nil paymentID selects the least
+	// re-driven ones that can still be retried, up to maxRedrives times each
+	RequeueFailedPayments(ctx context.Context, paymentID *uuid.UUID, owner string, limit, maxRedrives int) ([]models.Payment, error)
+	
+	// ClaimStuckPayments returns up to limit payments owned by owner that have
+	// been processing since before stuckBefore, refreshing their updated_at
+	// so the next sweep doesn't return them again
+	ClaimStuckPayments(ctx context.Context, owner string, stuckBefore time.Time, limit int) ([]models.Payment, error)
+	
+	// ExpirePendingPayments marks failed up to limit payments owned by owner
+	// still pending though requested before requestedBefore, returning how
+	// many it expired
+	ExpirePendingPayments(ctx context.Context, owner string, requestedBefore time.Time, limit int) (int, error)
+	
+	// RecordPaymentEvent appends a status transition to the payment's history
+	RecordPaymentEvent(ctx context.Context, event models.PaymentEvent) error
+	
+	// GetPaymentHistory returns the payment's status transitions, oldest first
+	GetPaymentHistory(ctx context.Context, paymentID uuid.UUID) ([]models.PaymentEvent, error)
+}
+
+// ErrPaymentNotFound is returned by lookups when no payment matches.
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// uniqueViolation is the Postgres error code for a unique constraint
+// violation; on payments the only one that can fire is correlation_id.
+const uniqueViolation = "23505"
+
+// ErrDuplicateCorrelationID is returned by CreatePayment when a payment with
+// the same correlationId already exists.
+var ErrDuplicateCorrelationID = errors.New("duplicate correlationId")
+
+// ErrPaymentAlreadyCompleted is returned by status updates and completions
+// that target a payment which is already completed. A completed payment is
+// final: its status, fee and processor never change again.
+var ErrPaymentAlreadyCompleted = errors.New("payment already completed")
+
+// ErrPaymentCancelled is returned by status updates and completions that
+// target a cancelled payment.
+var ErrPaymentCancelled = errors.New("payment cancelled")
+
+// ErrPaymentNotCancellable is returned by CancelPayment once a worker has
+// started on the payment.
+var ErrPaymentNotCancellable = errors.New("payment can no longer be cancelled")
+
+// IsUnavailable reports whether err means the database could not be reached,
+// as opposed to the server rejecting the statement (constraint violations,
+// bad input), which retrying would not fix.
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr)
 }
 
 type service struct {
-	db *sql.DB
+	pool    *pgxpool.Pool
+	batcher *batchWriter
+	// replicas serve GetPaymentSummary when configured; nil otherwise
+	replicas *replicaSet
+	// summary holds the summary queries for the configured from/to column
+	summary summaryStatements
 }
 
 var (
@@ -62,16 +186,56 @@ func New() Service {
 		return dbInstance
 	}
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
-	db, err := sql.Open("pgx", connStr)
+	config, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbInstance = &service{
-		db: db,
+	
+	// Statements are prepared once per connection and reused from the cache
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if maxConns, err := strconv.Atoi(os.Getenv("BLUEPRINT_DB_MAX_CONNS")); err == nil && maxConns > 0 {
+		config.MaxConns = int32(maxConns)
+	}
+	if minConns, err := strconv.Atoi(os.Getenv("BLUEPRINT_DB_MIN_CONNS")); err == nil && minConns >= 0 {
+		config.MinConns = int32(minConns)
 	}
+	
+	s := &service{summary: newSummaryStatements(summaryColumnFromEnv())}
+	config.AfterConnect = s.prepareStatements
+	
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.pool = pool
+	s.replicas = newReplicaSetFromEnv(config)
+	s.batcher = newBatchWriterFromEnv(s)
+	dbInstance = s
 	return dbInstance
 }
 
+// summaryColumns are the timestamps GetPaymentSummary can filter on.
+var summaryColumns = map[string]bool{
+	"requested_at": true,
+	"created_at":   true,
+	"processed_at": true,
+}
+
+// summaryColumnFromEnv reads SUMMARY_FILTER_COLUMN. The default,
+// requested_at, is the timestamp sent to the processors, so the summary
+// matches what they report for the same from/to window.
+func summaryColumnFromEnv() string {
+	column := os.Getenv("SUMMARY_FILTER_COLUMN")
+	if column == "" {
+		return "requested_at"
+	}
+	if !summaryColumns[column] {
+		slog.Warn("ignoring SUMMARY_FILTER_COLUMN", "column", column)
+		return "requested_at"
+	}
+	return column
+}
+
 // Health checks the health of the database connection by pinging the database.
 // It returns a map with keys indicating various health statistics.
 func (s *service) Health() map[string]string {
@@ -81,11 +245,11 @@ func (s *service) Health() map[string]string {
 	stats := make(map[string]string)
 
 	// Ping the database
-	err := s.db.PingContext(ctx)
+	err := s.pool.Ping(ctx)
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log the error and terminate the program
+		slog.Warn("database health check failed", "error", err)
 		return stats
 	}
 
@@ -93,30 +257,31 @@ func (s *service) Health() map[string]string {
 	stats["status"] = "up"
 	stats["message"] = "It's healthy"
 
-	// Get database stats (like open connections, in use, idle, etc.)
-	dbStats := s.db.Stats()
-	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
-	stats["in_use"] = strconv.Itoa(dbStats.InUse)
-	stats["idle"] = strconv.Itoa(dbStats.Idle)
-	stats["wait_count"] = strconv.FormatInt(dbStats.WaitCount, 10)
-	stats["wait_duration"] = dbStats.WaitDuration.String()
-	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
-	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
+	// Get pool stats (like open connections, in use, idle, etc.)
+	dbStats := s.pool.Stat()
+	stats["open_connections"] = strconv.Itoa(int(dbStats.TotalConns()))
+	stats["max_connections"] = strconv.Itoa(int(dbStats.MaxConns()))
+	stats["in_use"] = strconv.Itoa(int(dbStats.AcquiredConns()))
+	stats["idle"] = strconv.Itoa(int(dbStats.IdleConns()))
+	stats["wait_count"] = strconv.FormatInt(dbStats.EmptyAcquireCount(), 10)
+	stats["wait_duration"] = dbStats.AcquireDuration().String()
+	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleDestroyCount(), 10)
+	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeDestroyCount(), 10)
 
 	// Evaluate stats to provide a health message
-	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
+	if dbStats.TotalConns() > dbStats.MaxConns()*4/5 {
 		stats["message"] = "The database is experiencing heavy load."
 	}
 
-	if dbStats.WaitCount > 1000 {
+	if dbStats.EmptyAcquireCount() > 1000 {
 		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
 	}
 
-	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
+	if dbStats.MaxIdleDestroyCount() > int64(dbStats.TotalConns())/2 {
 		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
 	}
 
-	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
+	if dbStats.MaxLifetimeDestroyCount() > int64(dbStats.TotalConns())/2 {
 		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
 	}
 
@@ -128,20 +293,59 @@ func (s *service) Health() map[string]string {
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
-	return s.db.Close()
+	if s.batcher != nil {
+		s.batcher.close()
+	}
+	slog.Info("disconnected from database", "database", database)
+	s.pool.Close()
+	if s.replicas != nil {
+		s.replicas.close()
+	}
+	return nil
+}
+
+// WarmUp establishes connections up front and keeps them idle in the pool.
+func (s *service) WarmUp(ctx context.Context, connections int) error {
+	conns := make([]*pgxpool.Conn, 0, connections)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+
+	for i := 0; i < connections; i++ {
+		conn, err := s.pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to open warm-up connection: %w", err)
+		}
+		conns = append(conns, conn)
+
+		if err := conn.Ping(ctx); err != nil {
+			return fmt.Errorf("failed to ping warm-up connection: %w", err)
+		}
+	}
+
+	return nil
 }
 
-// CreatePayment creates a new payment record in the database
+// CreatePayment creates a new payment record in the database, batching it
+// with concurrent inserts when the batch writer is enabled
 func (s *service) CreatePayment(ctx context.Context, payment *models.Payment) error {
-	query := `
-		INSERT INTO payments (correlation_id, amount, status, requested_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, requested_at, created_at, updated_at`
-	
-	err := s.db.QueryRowContext(ctx, query, 
+	if s.batcher != nil {
+		return s.batcher.insert(ctx, payment)
+	}
+	return s.insertPayment(ctx, payment)
+}
+
+func (s *service) insertPayment(ctx context.Context, payment *models.Payment) error {
+	err := s.pool.QueryRow(ctx, insertPaymentSQL, 
 		payment.CorrelationID, 
 		payment.Amount, 
+		payment.Currency,
+		payment.OriginalAmount,
+		payment.TenantID,
+		payment.OwnerInstance,
+		payment.CallbackURL,
 		payment.Status, 
 		payment.RequestedAt).Scan(
 		&payment.ID, 
@@ -149,6 +353,10 @@ func (s *service) CreatePayment(ctx context.Context, payment *models.Payment) er
 		&payment.CreatedAt, 
 		&payment.UpdatedAt)
 	
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %w", ErrDuplicateCorrelationID, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create payment: %w", err)
 	}
@@ -156,85 +364,178 @@ func (s *service) CreatePayment(ctx context.Context, payment *models.Payment) er
 	return nil
 }
 
-// UpdatePaymentStatus updates the status of a payment
-func (s *service) UpdatePaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus) error {
-	query := `UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+// paymentColumns lists the columns scanPayment expects, in order
+const paymentColumns = `id, correlation_id, amount, currency, original_amount, tenant_id, owner_instance, callback_url,
+	fee, processor_type, latency_ms, status, requested_at, processed_at, created_at, updated_at`
+
+func scanPayment(row pgx.Row) (*models.Payment, error) {
+	var payment models.Payment
+	err := row.Scan(
+		&payment.ID,
+		&payment.CorrelationID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.OriginalAmount,
+		&payment.TenantID,
+		&payment.OwnerInstance,
+		&payment.CallbackURL,
+		&payment.Fee,
+		&payment.ProcessorType,
+		&payment.LatencyMs,
+		&payment.Status,
+		&payment.RequestedAt,
+		&payment.ProcessedAt,
+		&payment.CreatedAt,
+		&payment.UpdatedAt)
 	
-	result, err := s.db.ExecContext(ctx, query, status, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update payment status: %w", err)
+		return nil, fmt.Errorf("failed to get payment: %w", err)
 	}
 	
-	rowsAffected, err := result.RowsAffected()
+	return &payment, nil
+}
+
+// GetPayment returns a single payment by its ID
+func (s *service) GetPayment(ctx context.Context, paymentID uuid.UUID) (*models.Payment, error) {
+	return scanPayment(s.pool.QueryRow(ctx, getPaymentSQL, paymentID))
+}
+
+// GetPaymentByCorrelationID returns a single payment by the correlationId
+// the client submitted
+func (s *service) GetPaymentByCorrelationID(ctx context.Context, correlationID uuid.UUID) (*models.Payment, error) {
+	return scanPayment(s.pool.QueryRow(ctx, getPaymentByCorrelationSQL, correlationID))
+}
+
+// UpdatePaymentStatus updates the status of a payment
+func (s *service) UpdatePaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus) error {
+	result, err := s.pool.Exec(ctx, updatePaymentStatusSQL, status, paymentID, models.PaymentStatusCompleted, models.PaymentStatusCancelled)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to update payment status: %w", err)
 	}
 	
-	if rowsAffected == 0 {
-		return fmt.Errorf("payment not found: %s", paymentID)
+	if result.RowsAffected() == 0 {
+		return s.finalStatusError(ctx, paymentID)
 	}
 	
 	return nil
 }
 
-// CompletePayment updates payment with final processing details
-func (s *service) CompletePayment(ctx context.Context, paymentID uuid.UUID, fee float64, processorType string) error {
-	query := `
-		UPDATE payments 
-		SET status = $1, fee = $2, processor_type = $3, processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = $4`
-	
-	result, err := s.db.ExecContext(ctx, query, models.PaymentStatusCompleted, fee, processorType, paymentID)
+// TransitionPaymentStatus updates the status of a payment only when its
+// current status is one of from
+func (s *service) TransitionPaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus, from ...models.PaymentStatus) (bool, error) {
+	fromStatuses := make([]string, len(from))
+	for i, f := range from {
+		fromStatuses[i] = string(f)
+	}
+
+	result, err := s.pool.Exec(ctx, transitionPaymentStatusSQL, status, paymentID, fromStatuses)
 	if err != nil {
-		return fmt.Errorf("failed to complete payment: %w", err)
+		return false, fmt.Errorf("failed to transition payment status: %w", err)
 	}
-	
-	rowsAffected, err := result.RowsAffected()
+	return result.RowsAffected() > 0, nil
+}
+
+// FailPayment marks a payment failed and records why
+func (s *service) FailPayment(ctx context.Context, paymentID uuid.UUID, reason models.FailureReason) error {
+	result, err := s.pool.Exec(ctx, failPaymentSQL, models.PaymentStatusFailed, reason, paymentID, models.PaymentStatusCompleted, models.PaymentStatusCancelled)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to fail payment: %w", err)
 	}
-	
-	if rowsAffected == 0 {
-		return fmt.Errorf("payment not found: %s", paymentID)
+
+	if result.RowsAffected() == 0 {
+		return s.finalStatusError(ctx, paymentID)
 	}
-	
+
 	return nil
 }
 
-// GetPaymentSummary returns payment summary grouped by processor type
-func (s *service) GetPaymentSummary(ctx context.Context, startDate, endDate *time.Time) (models.PaymentSummaryResponse, error) {
-	log.Printf("GetPaymentSummary called with startDate: %v, endDate: %v", startDate, endDate)
-	
-	// Build query with optional date filtering
-	query := `
-		SELECT 
-			COALESCE(processor_type, 'unknown') as processor_type,
-			COALESCE(SUM(amount), 0) as total_amount,
-			COUNT(*) as total_requests
-		FROM payments`
-	
-	var args []interface{}
-	var conditions []string
-	
-	if startDate != nil {
-		conditions = append(conditions, "created_at >= $"+fmt.Sprintf("%d", len(args)+1))
-		args = append(args, *startDate)
+// ExpirePayment marks a payment failed as expired only while it is pending
+func (s *service) ExpirePayment(ctx context.Context, paymentID uuid.UUID) (bool, error) {
+	result, err := s.pool.Exec(ctx, expirePaymentSQL, models.PaymentStatusFailed, models.FailureReasonExpired, paymentID, models.PaymentStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire payment: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// CompletePayment updates payment with final processing details. A zero
+// latency (the payment was found already charged) is stored as NULL.
+func (s *service) CompletePayment(ctx context.Context, paymentID uuid.UUID, fee models.Money, processorType string, latency time.Duration) error {
+	var latencyMs *int64
+	if latency > 0 {
+		ms := latency.Milliseconds()
+		latencyMs = &ms
+	}
+
+	result, err := s.pool.Exec(ctx, completePaymentSQL, models.PaymentStatusCompleted, fee, processorType, paymentID, models.PaymentStatusCancelled, latencyMs)
+	if err != nil {
+		return fmt.Errorf("failed to complete payment: %w", err)
 	}
 	
-	if endDate != nil {
-		conditions = append(conditions, "created_at <= $"+fmt.Sprintf("%d", len(args)+1))
-		args = append(args, *endDate)
+	if result.RowsAffected() == 0 {
+		return s.finalStatusError(ctx, paymentID)
 	}
 	
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+	return nil
+}
+
+// CancelPayment cancels a payment that no worker has started yet.
+func (s *service) CancelPayment(ctx context.Context, paymentID uuid.UUID) error {
+	query := `UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = $3`
+
+	result, err := s.pool.Exec(ctx, query, models.PaymentStatusCancelled, paymentID, models.PaymentStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel payment: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		var status models.PaymentStatus
+		err := s.pool.QueryRow(ctx, `SELECT status FROM payments WHERE id = $1`, paymentID).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPaymentNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get payment status: %w", err)
+		}
+		return ErrPaymentNotCancellable
+	}
+
+	return nil
+}
+
+// finalStatusError explains why a guarded update matched no row. Since
+// correlation_id is unique there is one row per correlationId, so this guard
+// is what keeps a payment from being completed twice.
+func (s *service) finalStatusError(ctx context.Context, paymentID uuid.UUID) error {
+	var status models.PaymentStatus
+	err := s.pool.QueryRow(ctx, `SELECT status FROM payments WHERE id = $1`, paymentID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("payment not found: %s", paymentID)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to get payment status: %w", err)
+	}
+	switch status {
+	case models.PaymentStatusCompleted:
+		return ErrPaymentAlreadyCompleted
+	case models.PaymentStatusCancelled:
+		return ErrPaymentCancelled
+	}
+	return fmt.Errorf("payment %s was not updated", paymentID)
+}
+
+// GetPaymentSummary returns payment summary grouped by processor type
+func (s *service) GetPaymentSummary(ctx context.Context, startDate, endDate *time.Time, tenantID *string) (models.PaymentSummaryResponse, error) {
+	logging.HotPath("computing payment summary", "startDate", startDate, "endDate", endDate, "tenantId", tenantID)
 	
-	query += ` GROUP BY processor_type ORDER BY processor_type`
+	query, args := s.summary.query(startDate, endDate, tenantID)
 	
-	log.Printf("Executing query: %s with args: %v", query, args)
+	logging.HotPath("executing payment summary query", "query", query, "args", args)
 	
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.queryRead(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payment summary: %w", err)
 	}
@@ -244,17 +545,21 @@ func (s *service) GetPaymentSummary(ctx context.Context, startDate, endDate *tim
 	
 	for rows.Next() {
 		var processorType string
-		var totalAmount float64
+		var totalAmount models.Money
 		var totalRequests int
+		var totalFee models.Money
 		
-		err := rows.Scan(&processorType, &totalAmount, &totalRequests)
+		err := rows.Scan(&processorType, &totalAmount, &totalRequests, &totalFee)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan payment summary: %w", err)
 		}
 		
+		netAmount := totalAmount - totalFee
 		result[processorType] = models.ProcessorSummary{
 			TotalRequests: totalRequests,
 			TotalAmount:   totalAmount,
+			TotalFee:      &totalFee,
+			NetAmount:     &netAmount,
 		}
 	}
 	
@@ -265,11 +570,24 @@ func (s *service) GetPaymentSummary(ctx context.Context, startDate, endDate *tim
 	return result, nil
 }
 
+// DeletePayment removes a pending payment; its events go with it through the
+// foreign key.
+func (s *service) DeletePayment(ctx context.Context, paymentID uuid.UUID) error {
+	result, err := s.pool.Exec(ctx, `DELETE FROM payments WHERE id = $1 AND status = $2`, paymentID, models.PaymentStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to delete payment: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPaymentNotFound
+	}
+	return nil
+}
+
 // ClearPayments removes all payments from the table (for testing)
 func (s *service) ClearPayments(ctx context.Context) error {
-	query := `TRUNCATE TABLE payments`
+	query := `TRUNCATE TABLE payments, payment_events`
 	
-	_, err := s.db.ExecContext(ctx, query)
+	_, err := s.pool.Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to clear payments: %w", err)
 	}
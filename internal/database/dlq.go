@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// notRedriven are the failure reasons a batch re-drive leaves alone: the
+// processor refused the payment, or it is already too old to be worth paying.
+var notRedriven = []string{
+	string(models.FailureReasonRejected),
+	string(models.FailureReasonExpired),
+	string(models.FailureReasonMaxAge),
+}
+
+// RequeueFailedPayments resets up to limit failed payments (or only paymentID
+// when set) to pending under owner and returns them. Without a paymentID it
+// skips the notRedriven failures and those already re-driven maxRedrives
+// times, least re-driven first so a batch that keeps failing doesn't hold back
+// newer failures. SKIP LOCKED lets several instances re-drive the failed set
+// concurrently without sharing rows. The transition is recorded in the
+// payment history with actor "dlq".
+func (s *service) RequeueFailedPayments(ctx context.Context, paymentID *uuid.UUID, owner string, limit, maxRedrives int) ([]models.Payment, error) {
+	query := `
+		WITH requeued AS (
+			UPDATE payments p
+			SET status = $1, owner_instance = $2, fee = NULL, processor_type = NULL, processed_at = NULL, latency_ms = NULL,
+				failure_reason = NULL, redrive_count = p.redrive_count + 1, updated_at = CURRENT_TIMESTAMP
+			FROM (
+				SELECT id FROM payments
+				WHERE status = $3 AND (
+					id = $4 OR
+					($4::uuid IS NULL AND redrive_count < $6 AND (failure_reason IS NULL OR failure_reason <> ALL($7)))
+				)
+				ORDER BY redrive_count, updated_at
+				LIMIT $5
+				FOR UPDATE SKIP LOCKED
+			) failed
+			WHERE p.id = failed.id
+			RETURNING p.id, p.correlation_id, p.amount, p.tenant_id, p.callback_url, p.requested_at
+		), logged AS (
+			INSERT INTO payment_events (payment_id, status, actor)
+			SELECT id, $1, 'dlq' FROM requeued
+		)
+		SELECT id, correlation_id, amount, tenant_id, callback_url, requested_at FROM requeued`
+
+	rows, err := s.pool.Query(ctx, query, models.PaymentStatusPending, owner, models.PaymentStatusFailed, paymentID, limit, maxRedrives, notRedriven)
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue failed payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		p := models.Payment{Status: models.PaymentStatusPending, OwnerInstance: &owner}
+		if err := rows.Scan(&p.ID, &p.CorrelationID, &p.Amount, &p.TenantID, &p.CallbackURL, &p.RequestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan requeued payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate requeued payments: %w", err)
+	}
+
+	return payments, nil
+}
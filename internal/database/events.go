@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// RecordPaymentEvent appends event to the payment_events trail.
+func (s *service) RecordPaymentEvent(ctx context.Context, event models.PaymentEvent) error {
+	if _, err := s.pool.Exec(ctx, recordPaymentEventSQL, event.PaymentID, event.Status, event.Actor, event.ProcessorType, event.Error); err != nil {
+		return fmt.Errorf("failed to record payment event: %w", err)
+	}
+
+	return nil
+}
+
+// GetPaymentHistory returns every recorded transition of the payment in the
+// order they happened.
+func (s *service) GetPaymentHistory(ctx context.Context, paymentID uuid.UUID) ([]models.PaymentEvent, error) {
+	query := `
+		SELECT id, payment_id, status, actor, processor_type, error, created_at
+		FROM payment_events
+		WHERE payment_id = $1
+		ORDER BY id`
+
+	rows, err := s.pool.Query(ctx, query, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment history: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.PaymentEvent, 0)
+	for rows.Next() {
+		var e models.PaymentEvent
+		if err := rows.Scan(&e.ID, &e.PaymentID, &e.Status, &e.Actor, &e.ProcessorType, &e.Error, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan payment event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate payment history: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"rinha-backend-2025/internal/models"
+)
+
+// RegisterInstance inserts the instance or, if it restarted with the same ID,
+// resets its heartbeat.
+func (s *service) RegisterInstance(ctx context.Context, instanceID string) error {
+	query := `
+		INSERT INTO instances (id, started_at, last_heartbeat)
+		VALUES ($1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET started_at = EXCLUDED.started_at, last_heartbeat = EXCLUDED.last_heartbeat`
+
+	if _, err := s.pool.Exec(ctx, query, instanceID); err != nil {
+		return fmt.Errorf("failed to register instance: %w", err)
+	}
+
+	return nil
+}
+
+// HeartbeatInstance refreshes the heartbeat, re-registering the instance if a
+// peer already reclaimed it.
+func (s *service) HeartbeatInstance(ctx context.Context, instanceID string) error {
+	query := `UPDATE instances SET last_heartbeat = CURRENT_TIMESTAMP WHERE id = $1`
+
+	result, err := s.pool.Exec(ctx, query, instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to heartbeat instance: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return s.RegisterInstance(ctx, instanceID)
+	}
+
+	return nil
+}
+
+// ExpireInstance backdates the heartbeat so peers reclaim whatever the
+// instance leaves unfinished without waiting for the stale timeout.
+func (s *service) ExpireInstance(ctx context.Context, instanceID string) error {
+	query := `UPDATE instances SET last_heartbeat = 'epoch' WHERE id = $1`
+
+	if _, err := s.pool.Exec(ctx, query, instanceID); err != nil {
+		return fmt.Errorf("failed to expire instance: %w", err)
+	}
+
+	return nil
+}
+
+// ReclaimPayments removes stale instances from the registry and moves their
+// pending and processing payments to newOwner in a single transaction.
+// SKIP LOCKED ensures that when several instances race, each stale peer is
+// reclaimed by exactly one of them.
+func (s *service) ReclaimPayments(ctx context.Context, staleBefore time.Time, newOwner string) ([]models.Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin reclaim transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	staleQuery := `
+		DELETE FROM instances
+		WHERE id IN (
+			SELECT id FROM instances
+			WHERE last_heartbeat < $1 AND id <> $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`
+
+	rows, err := tx.Query(ctx, staleQuery, staleBefore, newOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale instances: %w", err)
+	}
+
+	var stale []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan stale instance: %w", err)
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate stale instances: %w", err)
+	}
+
+	if len(stale) == 0 {
+		return nil, tx.Commit(ctx)
+	}
+
+	payments, err := reclaimFrom(ctx, tx, stale, newOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit reclaim transaction: %w", err)
+	}
+
+	return payments, nil
+}
+
+// ReclaimOwnPayments moves owner's pending and processing payments back to
+// pending. Called when the instance registers, before it queues anything,
+// so every such payment was left by a previous run under the same ID.
+func (s *service) ReclaimOwnPayments(ctx context.Context, owner string) ([]models.Payment, error) {
+	return reclaimFrom(ctx, s.pool, []string{owner}, owner)
+}
+
+// querier is what reclaimFrom needs from a pool or a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// reclaimFrom moves the pending and processing payments of owners to
+// newOwner as pending. The returned status is the one before the reclaim, so
+// callers can tell payments that may already have reached a processor. The
+// move back to pending is recorded in the payment history with actor
+// "reclaim".
+func reclaimFrom(ctx context.Context, q querier, owners []string, newOwner string) ([]models.Payment, error) {
+	reclaimQuery := `
+		WITH reclaimed AS (
+			UPDATE payments p
+			SET owner_instance = $1, status = $2, updated_at = CURRENT_TIMESTAMP
+			FROM (SELECT id, status FROM payments WHERE owner_instance = ANY($3) AND status IN ($2, $4) FOR UPDATE) prev
+			WHERE p.id = prev.id
+			RETURNING p.id, p.correlation_id, p.amount, p.tenant_id, p.callback_url, p.requested_at, prev.status
+		), logged AS (
+			INSERT INTO payment_events (payment_id, status, actor)
+			SELECT id, $2, 'reclaim' FROM reclaimed
+		)
+		SELECT id, correlation_id, amount, tenant_id, callback_url, requested_at, status FROM reclaimed`
+
+	rows, err := q.Query(ctx, reclaimQuery, newOwner, models.PaymentStatusPending, owners, models.PaymentStatusProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reclaim payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		var p models.Payment
+		if err := rows.Scan(&p.ID, &p.CorrelationID, &p.Amount, &p.TenantID, &p.CallbackURL, &p.RequestedAt, &p.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan reclaimed payment: %w", err)
+		}
+		p.OwnerInstance = &newOwner
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate reclaimed payments: %w", err)
+	}
+	return payments, nil
+}
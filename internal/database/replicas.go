@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaSet spreads read-only queries over the pools of the configured read
+// replicas, round robin.
+type replicaSet struct {
+	pools []*pgxpool.Pool
+	next  atomic.Uint64
+}
+
+// newReplicaSetFromEnv connects to every DSN in BLUEPRINT_DB_REPLICA_URLS
+// (comma separated), with the same pool settings as the primary. It returns
+// nil when none is configured. Pools connect lazily, so a replica that is down
+// at startup only costs a fallback to the primary.
+func newReplicaSetFromEnv(primary *pgxpool.Config) *replicaSet {
+	var pools []*pgxpool.Pool
+	for _, dsn := range strings.Split(os.Getenv("BLUEPRINT_DB_REPLICA_URLS"), ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+
+		config, err := pgxpool.ParseConfig(dsn)
+		if err != nil {
+			slog.Error("ignoring invalid read replica DSN", "error", err)
+			continue
+		}
+		config.ConnConfig.DefaultQueryExecMode = primary.ConnConfig.DefaultQueryExecMode
+		config.MaxConns = primary.MaxConns
+		config.MinConns = primary.MinConns
+		config.AfterConnect = primary.AfterConnect
+
+		pool, err := pgxpool.NewWithConfig(context.Background(), config)
+		if err != nil {
+			slog.Error("failed to create read replica pool", "host", config.ConnConfig.Host, "error", err)
+			continue
+		}
+		pools = append(pools, pool)
+	}
+
+	if len(pools) == 0 {
+		return nil
+	}
+	slog.Info("routing summary queries to read replicas", "replicas", len(pools))
+	return &replicaSet{pools: pools}
+}
+
+func (r *replicaSet) pick() *pgxpool.Pool {
+	return r.pools[r.next.Add(1)%uint64(len(r.pools))]
+}
+
+func (r *replicaSet) close() {
+	for _, pool := range r.pools {
+		pool.Close()
+	}
+}
+
+// queryRead runs a read-only query on a replica when there are any, falling
+// back to the primary if the replica can't be reached.
+func (s *service) queryRead(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if s.replicas == nil {
+		return s.pool.Query(ctx, sql, args...)
+	}
+
+	rows, err := s.replicas.pick().Query(ctx, sql, args...)
+	if err != nil && IsUnavailable(err) && ctx.Err() == nil {
+		slog.Warn("read replica unavailable, querying the primary", "error", err)
+		return s.pool.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Hot-path statements. Each is prepared on every new connection under its own
+// text as the name, so callers pass the constant as the query and pgx picks
+// the prepared statement up. If preparing fails the same text still runs
+// through the regular statement cache.
+const (
+	insertPaymentSQL = `
+		INSERT INTO payments (correlation_id, amount, currency, original_amount, tenant_id, owner_instance, callback_url, status, requested_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, requested_at, created_at, updated_at`
+
+	getPaymentSQL = `SELECT ` + paymentColumns + ` FROM payments WHERE id = $1`
+
+	getPaymentByCorrelationSQL = `SELECT ` + paymentColumns + ` FROM payments WHERE correlation_id = $1`
+
+	updatePaymentStatusSQL = `UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status NOT IN ($3, $4)`
+
+	transitionPaymentStatusSQL = `UPDATE payments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = ANY($3)`
+
+	failPaymentSQL = `UPDATE payments SET status = $1, failure_reason = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND status NOT IN ($4, $5)`
+
+	expirePaymentSQL = `UPDATE payments SET status = $1, failure_reason = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND status = $4`
+
+	completePaymentSQL = `
+		UPDATE payments 
+		SET status = $1, fee = $2, processor_type = $3, latency_ms = $6, processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = $4 AND status NOT IN ($1, $5)`
+
+	recordPaymentEventSQL = `
+		INSERT INTO payment_events (payment_id, status, actor, processor_type, error)
+		VALUES ($1, $2, $3, $4, $5)`
+)
+
+// summaryStatements are the GetPaymentSummary variants for the configured
+// filter column. A missing from or to bound is sent as -infinity/infinity so
+// one-sided ranges reuse the dated variant.
+type summaryStatements struct {
+	all           string
+	between       string
+	tenant        string
+	tenantBetween string
+}
+
+func newSummaryStatements(column string) summaryStatements {
+	const (
+		selectSummary = `
+		SELECT 
+			COALESCE(processor_type, 'unknown') as processor_type,
+			COALESCE(SUM(amount), 0) as total_amount,
+			COUNT(*) as total_requests,
+			COALESCE(SUM(fee), 0) as total_fee
+		FROM payments`
+		groupSummary = ` GROUP BY processor_type ORDER BY processor_type`
+	)
+	between := column + ` >= $1 AND ` + column + ` <= $2`
+
+	return summaryStatements{
+		all:           selectSummary + groupSummary,
+		between:       selectSummary + ` WHERE ` + between + groupSummary,
+		tenant:        selectSummary + ` WHERE tenant_id = $1` + groupSummary,
+		tenantBetween: selectSummary + ` WHERE ` + between + ` AND tenant_id = $3` + groupSummary,
+	}
+}
+
+// query picks the variant for the given filters and returns it with its
+// arguments.
+func (st summaryStatements) query(startDate, endDate *time.Time, tenantID *string) (string, []any) {
+	dated := startDate != nil || endDate != nil
+	switch {
+	case dated && tenantID != nil:
+		return st.tenantBetween, []any{lowerBound(startDate), upperBound(endDate), *tenantID}
+	case dated:
+		return st.between, []any{lowerBound(startDate), upperBound(endDate)}
+	case tenantID != nil:
+		return st.tenant, []any{*tenantID}
+	default:
+		return st.all, nil
+	}
+}
+
+func lowerBound(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+func upperBound(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+func (s *service) statementTexts() []string {
+	return []string{
+		insertPaymentSQL,
+		getPaymentSQL,
+		getPaymentByCorrelationSQL,
+		updatePaymentStatusSQL,
+		transitionPaymentStatusSQL,
+		failPaymentSQL,
+		expirePaymentSQL,
+		completePaymentSQL,
+		recordPaymentEventSQL,
+		s.summary.all,
+		s.summary.between,
+		s.summary.tenant,
+		s.summary.tenantBetween,
+	}
+}
+
+// prepareStatements runs as the pool's AfterConnect hook. A statement that
+// fails to prepare (e.g. the schema isn't there yet) is only logged, since it
+// still works unprepared.
+func (s *service) prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for _, sql := range s.statementTexts() {
+		if _, err := conn.Prepare(ctx, sql, sql); err != nil {
+			slog.Warn("failed to prepare statement", "error", err)
+		}
+	}
+	return nil
+}
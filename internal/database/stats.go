@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rinha-backend-2025/internal/models"
+)
+
+const processorStatsSQL = `
+	SELECT
+		processor_type,
+		COUNT(*),
+		COALESCE(SUM(fee), 0),
+		COALESCE(AVG(latency_ms), 0)::float8,
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY latency_ms), 0),
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms), 0)
+	FROM payments
+	WHERE status = $1 AND processed_at >= $2 AND processor_type IS NOT NULL
+	GROUP BY processor_type`
+
+// GetProcessorStats aggregates the completed payments of each processor. It
+// is served by a read replica when one is configured.
+func (s *service) GetProcessorStats(ctx context.Context, since time.Time) (map[string]models.ProcessorStats, error) {
+	rows, err := s.queryRead(ctx, processorStatsSQL, models.PaymentStatusCompleted, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processor stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]models.ProcessorStats)
+	for rows.Next() {
+		var processorType string
+		var stats models.ProcessorStats
+		if err := rows.Scan(&processorType, &stats.Payments, &stats.TotalFee, &stats.AvgLatencyMs, &stats.P50LatencyMs, &stats.P95LatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan processor stats: %w", err)
+		}
+		result[processorType] = stats
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate processor stats: %w", err)
+	}
+
+	return result, nil
+}
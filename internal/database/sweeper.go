@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rinha-backend-2025/internal/models"
+)
+
+// ClaimStuckPayments finds payments left in processing, e.g. by a worker that
+// died between taking the payment and completing it. They keep their status,
+// since the processor may already have charged them, and the claim is
+// recorded in the payment history with actor "sweeper".
+func (s *service) ClaimStuckPayments(ctx context.Context, owner string, stuckBefore time.Time, limit int) ([]models.Payment, error) {
+	query := `
+		WITH stuck AS (
+			UPDATE payments p
+			SET updated_at = CURRENT_TIMESTAMP
+			FROM (
+				SELECT id FROM payments
+				WHERE status = $1 AND owner_instance = $2 AND updated_at < $3
+				ORDER BY updated_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			) old
+			WHERE p.id = old.id
+			RETURNING p.id, p.correlation_id, p.amount, p.tenant_id, p.callback_url, p.requested_at
+		), logged AS (
+			INSERT INTO payment_events (payment_id, status, actor)
+			SELECT id, $1, 'sweeper' FROM stuck
+		)
+		SELECT id, correlation_id, amount, tenant_id, callback_url, requested_at FROM stuck`
+
+	rows, err := s.pool.Query(ctx, query, models.PaymentStatusProcessing, owner, stuckBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim stuck payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		p := models.Payment{Status: models.PaymentStatusProcessing, OwnerInstance: &owner}
+		if err := rows.Scan(&p.ID, &p.CorrelationID, &p.Amount, &p.TenantID, &p.CallbackURL, &p.RequestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stuck payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate stuck payments: %w", err)
+	}
+
+	return payments, nil
+}
+
+// ExpirePendingPayments marks failed up to limit payments owned by owner
+// that are still pending although they were requested before
+// requestedBefore, recording the expiry in their history with actor
+// "sweeper". It returns how many it expired.
+func (s *service) ExpirePendingPayments(ctx context.Context, owner string, requestedBefore time.Time, limit int) (int, error) {
+	query := `
+		WITH expired AS (
+			UPDATE payments p
+			SET status = $1, failure_reason = $6, updated_at = CURRENT_TIMESTAMP
+			FROM (
+				SELECT id FROM payments
+				WHERE status = $2 AND owner_instance = $3 AND requested_at < $4
+				ORDER BY requested_at
+				LIMIT $5
+				FOR UPDATE SKIP LOCKED
+			) old
+			WHERE p.id = old.id
+			RETURNING p.id
+		), logged AS (
+			INSERT INTO payment_events (payment_id, status, actor, error)
+			SELECT id, $1, 'sweeper', 'expired while pending' FROM expired
+		)
+		SELECT count(*) FROM expired`
+
+	var expired int
+	err := s.pool.QueryRow(ctx, query, models.PaymentStatusFailed, models.PaymentStatusPending, owner, requestedBefore, limit, models.FailureReasonExpired).Scan(&expired)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending payments: %w", err)
+	}
+	return expired, nil
+}
@@ -0,0 +1,209 @@
+//go:build integration
+
+// Package integration runs the API binary against Postgres in a container and
+// fake payment processors, then checks that /payments-summary agrees with
+// what the processors recorded. Run it with make itest; it needs Docker.
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/testing/fakeprocessor"
+)
+
+const (
+	dbName = "rinha_db"
+	dbUser = "rinha"
+	dbPwd  = "password"
+)
+
+var dbHost, dbPort string
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	container, err := postgres.Run(ctx,
+		"postgres:latest",
+		postgres.WithDatabase(dbName),
+		postgres.WithUsername(dbUser),
+		postgres.WithPassword(dbPwd),
+		postgres.WithInitScripts(filepath.Join("..", "..", "sql", "init.sql")),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		log.Fatalf("could not start postgres container: %v", err)
+	}
+
+	if dbHost, err = container.Host(ctx); err != nil {
+		log.Fatalf("could not get postgres host: %v", err)
+	}
+	mapped, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		log.Fatalf("could not get postgres port: %v", err)
+	}
+	dbPort = mapped.Port()
+
+	code := m.Run()
+
+	if err := container.Terminate(ctx); err != nil {
+		log.Fatalf("could not teardown postgres container: %v", err)
+	}
+	os.Exit(code)
+}
+
+// startAPI builds cmd/api and runs it against the container and the given
+// processors, returning its base URL.
+func startAPI(t *testing.T, defaultURL, fallbackURL string) string {
+	binary := filepath.Join(t.TempDir(), "api")
+	build := exec.Command("go", "build", "-o", binary, "rinha-backend-2025/cmd/api")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("could not build the api: %v\n%s", err, out)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not pick a port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("PORT=%d", port),
+		"BLUEPRINT_DB_HOST="+dbHost,
+		"BLUEPRINT_DB_PORT="+dbPort,
+		"BLUEPRINT_DB_DATABASE="+dbName,
+		"BLUEPRINT_DB_USERNAME="+dbUser,
+		"BLUEPRINT_DB_PASSWORD="+dbPwd,
+		"BLUEPRINT_DB_SCHEMA=public",
+		"PAYMENT_PROCESSOR_URL_DEFAULT="+defaultURL,
+		"PAYMENT_PROCESSOR_URL_FALLBACK="+fallbackURL,
+		"PROCESSOR_RETRY_BASE_DELAY=1ms",
+	)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("could not start the api: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+		_ = cmd.Wait()
+	})
+
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		resp, err := http.Get(baseURL + "/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return baseURL
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("api did not become healthy: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func postPayment(t *testing.T, baseURL string, amount string) {
+	body := fmt.Sprintf(`{"correlationId": %q, "amount": %s}`, uuid.NewString(), amount)
+	resp, err := http.Post(baseURL+"/payments", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /payments: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /payments: expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+}
+
+func getSummary(t *testing.T, baseURL string) models.PaymentSummaryResponse {
+	resp, err := http.Get(baseURL + "/payments-summary?consistency=strong")
+	if err != nil {
+		t.Fatalf("GET /payments-summary: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var summary models.PaymentSummaryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("error decoding summary: %v", err)
+	}
+	return summary
+}
+
+func TestSummaryMatchesProcessors(t *testing.T) {
+	defaultProcessor := fakeprocessor.New(fakeprocessor.Options{Latency: 5 * time.Millisecond})
+	defer defaultProcessor.Close()
+	fallbackProcessor := fakeprocessor.New(fakeprocessor.Options{Latency: 5 * time.Millisecond})
+	defer fallbackProcessor.Close()
+
+	baseURL := startAPI(t, defaultProcessor.URL, fallbackProcessor.URL)
+
+	const payments = 100
+	for i := 0; i < payments; i++ {
+		// Take the default processor down for a stretch so both end up
+		// with payments
+		switch i {
+		case payments / 3:
+			defaultProcessor.SetFailing(true)
+		case 2 * payments / 3:
+			defaultProcessor.SetFailing(false)
+		}
+		postPayment(t, baseURL, "19.90")
+	}
+
+	processors := map[string]*fakeprocessor.Server{"default": defaultProcessor, "fallback": fallbackProcessor}
+	recorded := func() int {
+		total := 0
+		for _, processor := range processors {
+			requests, _ := processor.Summary()
+			total += requests
+		}
+		return total
+	}
+
+	var summary models.PaymentSummaryResponse
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		summary = getSummary(t, baseURL)
+		reported := summary["default"].TotalRequests + summary["fallback"].TotalRequests
+		if reported == payments && recorded() == payments {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d payments, summary reports %d and processors recorded %d", payments, reported, recorded())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for name, processor := range processors {
+		requests, amount := processor.Summary()
+		if got := summary[name]; got.TotalRequests != requests || got.TotalAmount != amount {
+			t.Errorf("%s: summary reports %d payments totalling %s, processor recorded %d totalling %s",
+				name, got.TotalRequests, got.TotalAmount, requests, amount)
+		}
+	}
+	if requests, _ := fallbackProcessor.Summary(); requests == 0 {
+		t.Error("expected the fallback to take payments while the default was failing")
+	}
+}
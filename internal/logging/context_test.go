@@ -0,0 +1,25 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDIsLoggedFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newHandler(&buf, "json")).With("component", "test")
+
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "with id")
+	logger.Info("without id")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.Contains(lines[0], `"requestId":"req-1"`) {
+		t.Errorf("expected the request ID on the first line, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "requestId") {
+		t.Errorf("expected no request ID without one in the context, got %s", lines[1])
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	level   slog.LevelVar
+	hotPath atomic.Bool
+)
+
+func init() {
+	if l, err := ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		level.Set(l)
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("LOG_HOT_PATH")); err == nil {
+		hotPath.Store(enabled)
+	}
+
+	slog.SetDefault(slog.New(newHandler(os.Stdout, os.Getenv("LOG_FORMAT"))))
+}
+
+// newHandler returns a JSON handler unless format is "text".
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: &level}
+	if strings.EqualFold(format, "text") {
+		return contextHandler{slog.NewTextHandler(w, opts)}
+	}
+	return contextHandler{slog.NewJSONHandler(w, opts)}
+}
+
+// ParseLevel accepts debug, info, warn or error (case insensitive).
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+func GetLevel() slog.Level {
+	return level.Level()
+}
+
+// LevelName returns the current level in the lowercase form ParseLevel accepts.
+func LevelName() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// SetHotPath toggles the per-request/per-job log lines, which are too noisy
+// to keep on during a load test.
+func SetHotPath(enabled bool) {
+	hotPath.Store(enabled)
+}
+
+func HotPathEnabled() bool {
+	return hotPath.Load()
+}
+
+// HotPath logs at info level, but only when hot-path logging is enabled.
+func HotPath(msg string, args ...any) {
+	if hotPath.Load() {
+		slog.Info(msg, args...)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// CountBucket is the count observed in the bucket starting at Start.
+type CountBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// RollingCounter counts events in fixed-width time buckets, keeping only the
+// most recent ones.
+type RollingCounter struct {
+	mu     sync.Mutex
+	width  time.Duration
+	counts []int64
+	starts []time.Time
+}
+
+func NewRollingCounter(buckets int, width time.Duration) *RollingCounter {
+	if buckets <= 0 {
+		buckets = 1
+	}
+
+	return &RollingCounter{
+		width:  width,
+		counts: make([]int64, buckets),
+		starts: make([]time.Time, buckets),
+	}
+}
+
+func (c *RollingCounter) Add(n int64) {
+	start := time.Now().Truncate(c.width)
+	i := c.index(start)
+
+	c.mu.Lock()
+	if !c.starts[i].Equal(start) {
+		c.starts[i] = start
+		c.counts[i] = 0
+	}
+	c.counts[i] += n
+	c.mu.Unlock()
+}
+
+// Buckets returns every bucket in the retained window, oldest first,
+// including the empty ones.
+func (c *RollingCounter) Buckets() []CountBucket {
+	current := time.Now().Truncate(c.width)
+	buckets := make([]CountBucket, len(c.counts))
+
+	c.mu.Lock()
+	for k := range buckets {
+		start := current.Add(-time.Duration(len(buckets)-1-k) * c.width)
+		buckets[k].Start = start
+		if i := c.index(start); c.starts[i].Equal(start) {
+			buckets[k].Count = c.counts[i]
+		}
+	}
+	c.mu.Unlock()
+
+	return buckets
+}
+
+func (c *RollingCounter) index(start time.Time) int {
+	return int((start.UnixNano() / int64(c.width)) % int64(len(c.counts)))
+}
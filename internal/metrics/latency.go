@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySnapshot is a point-in-time view of the latencies observed inside
+// the tracker window. Durations are reported in milliseconds.
+type LatencySnapshot struct {
+	Window string  `json:"window"`
+	Count  int     `json:"count"`
+	P50Ms  float64 `json:"p50Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// LatencyTracker keeps the most recent latency samples in a fixed-size ring
+// buffer and computes percentiles over the ones that fall inside the window.
+type LatencyTracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples []latencySample
+	next    int
+	full    bool
+}
+
+func NewLatencyTracker(window time.Duration, maxSamples int) *LatencyTracker {
+	if maxSamples <= 0 {
+		maxSamples = 1
+	}
+
+	return &LatencyTracker{
+		window:  window,
+		samples: make([]latencySample, maxSamples),
+	}
+}
+
+// Observe records a single latency sample.
+func (t *LatencyTracker) Observe(d time.Duration) {
+	t.mu.Lock()
+	t.samples[t.next] = latencySample{at: time.Now(), duration: d}
+	t.next++
+	if t.next == len(t.samples) {
+		t.next = 0
+		t.full = true
+	}
+	t.mu.Unlock()
+}
+
+// Snapshot returns p50/p95/p99 and max over the samples inside the window.
+func (t *LatencyTracker) Snapshot() LatencySnapshot {
+	cutoff := time.Now().Add(-t.window)
+
+	t.mu.Lock()
+	n := t.next
+	if t.full {
+		n = len(t.samples)
+	}
+	durations := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		if t.samples[i].at.After(cutoff) {
+			durations = append(durations, t.samples[i].duration)
+		}
+	}
+	t.mu.Unlock()
+
+	snapshot := LatencySnapshot{
+		Window: t.window.String(),
+		Count:  len(durations),
+	}
+	if len(durations) == 0 {
+		return snapshot
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	snapshot.P50Ms = toMillis(percentile(durations, 0.50))
+	snapshot.P95Ms = toMillis(percentile(durations, 0.95))
+	snapshot.P99Ms = toMillis(percentile(durations, 0.99))
+	snapshot.MaxMs = toMillis(durations[len(durations)-1])
+
+	return snapshot
+}
+
+// percentile expects sorted input and uses the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
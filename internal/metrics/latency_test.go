@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTrackerPercentiles(t *testing.T) {
+	tracker := NewLatencyTracker(time.Minute, 1000)
+	for i := 1; i <= 100; i++ {
+		tracker.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	snapshot := tracker.Snapshot()
+
+	if snapshot.Count != 100 {
+		t.Fatalf("expected 100 samples, got %d", snapshot.Count)
+	}
+	if snapshot.P50Ms != 50 {
+		t.Errorf("expected p50 to be 50ms, got %v", snapshot.P50Ms)
+	}
+	if snapshot.P95Ms != 95 {
+		t.Errorf("expected p95 to be 95ms, got %v", snapshot.P95Ms)
+	}
+	if snapshot.P99Ms != 99 {
+		t.Errorf("expected p99 to be 99ms, got %v", snapshot.P99Ms)
+	}
+	if snapshot.MaxMs != 100 {
+		t.Errorf("expected max to be 100ms, got %v", snapshot.MaxMs)
+	}
+}
+
+func TestLatencyTrackerRingBufferOverwritesOldest(t *testing.T) {
+	tracker := NewLatencyTracker(time.Minute, 10)
+	for i := 0; i < 10; i++ {
+		tracker.Observe(time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		tracker.Observe(time.Millisecond)
+	}
+
+	snapshot := tracker.Snapshot()
+
+	if snapshot.Count != 10 {
+		t.Fatalf("expected 10 samples, got %d", snapshot.Count)
+	}
+	if snapshot.MaxMs != 1 {
+		t.Errorf("expected old samples to be overwritten, max = %v", snapshot.MaxMs)
+	}
+}
+
+func TestLatencyTrackerEmpty(t *testing.T) {
+	snapshot := NewLatencyTracker(time.Minute, 10).Snapshot()
+
+	if snapshot.Count != 0 || snapshot.P99Ms != 0 {
+		t.Fatalf("expected empty snapshot, got %+v", snapshot)
+	}
+}
+
+func TestRollingCounterBuckets(t *testing.T) {
+	counter := NewRollingCounter(3, time.Hour)
+	counter.Add(2)
+	counter.Add(3)
+
+	buckets := counter.Buckets()
+	if len(buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(buckets))
+	}
+	if buckets[2].Count != 5 || buckets[0].Count != 0 || buckets[1].Count != 0 {
+		t.Errorf("expected only the current bucket to count 5, got %+v", buckets)
+	}
+	if !buckets[2].Start.Equal(time.Now().Truncate(time.Hour)) {
+		t.Errorf("expected the last bucket to be the current hour, got %v", buckets[2].Start)
+	}
+}
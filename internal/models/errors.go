@@ -0,0 +1,52 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Stable error codes for clients to branch on; messages may change.
+const (
+	ErrorCodeInvalidRequest        = "invalid_request"
+	ErrorCodeValidationFailed      = "validation_failed"
+	ErrorCodeUnsupportedCurrency   = "unsupported_currency"
+	ErrorCodeUnauthorized          = "unauthorized"
+	ErrorCodeForbidden             = "forbidden"
+	ErrorCodeNotFound              = "not_found"
+	ErrorCodeMethodNotAllowed      = "method_not_allowed"
+	ErrorCodeDuplicatePayment      = "duplicate_payment"
+	ErrorCodePaymentNotCancellable = "payment_not_cancellable"
+	ErrorCodeTooManyPending        = "too_many_pending"
+	ErrorCodeQueueFull             = "queue_full"
+	ErrorCodeInternal              = "internal_error"
+)
+
+// APIError is the body of every error response. The message is sent under
+// "error", the key clients read before codes existed.
+type APIError struct {
+	Status        int               `json:"-"`
+	Code          string            `json:"code"`
+	Message       string            `json:"error"`
+	Details       map[string]string `json:"details,omitempty"`
+	CorrelationID *uuid.UUID        `json:"correlationId,omitempty"`
+}
+
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WithDetails sets Details and returns e.
+func (e *APIError) WithDetails(details map[string]string) *APIError {
+	e.Details = details
+	return e
+}
+
+// WithCorrelationID sets the correlationId of the payment the error is about
+// and returns e.
+func (e *APIError) WithCorrelationID(id uuid.UUID) *APIError {
+	e.CorrelationID = &id
+	return e
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr error
+	}{
+		{"19.90", 1990, nil},
+		{"19.9", 1990, nil},
+		{"19", 1900, nil},
+		{"0.01", 1, nil},
+		{".5", 50, nil},
+		{"-3.25", -325, nil},
+		{"1.2300", 123, nil},
+		{"1.234", 0, ErrMoneyPrecision},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := ParseMoney("abc"); err == nil {
+		t.Error("expected error for non-numeric amount")
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	var req struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 19.90}`), &req); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if req.Amount != 1990 {
+		t.Fatalf("expected 1990 cents, got %d", req.Amount)
+	}
+
+	out, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(out) != `{"amount":19.90}` {
+		t.Errorf("unexpected JSON: %s", out)
+	}
+}
+
+func TestMoneySumDoesNotDrift(t *testing.T) {
+	var total Money
+	for i := 0; i < 1000; i++ {
+		total += MoneyFromFloat(0.1)
+	}
+	if total.String() != "100.00" {
+		t.Errorf("expected 100.00, got %s", total)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+	if err := m.Scan("1234.56"); err != nil || m != 123456 {
+		t.Errorf("Scan(string) = %v, %v", m, err)
+	}
+	if err := m.Scan([]byte("10.5")); err != nil || m != 1050 {
+		t.Errorf("Scan([]byte) = %v, %v", m, err)
+	}
+	if err := m.Scan("3.33333"); err != nil || m != 333 {
+		t.Errorf("Scan(extra precision) = %v, %v", m, err)
+	}
+}
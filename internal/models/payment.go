@@ -1,8 +1,8 @@
 package models
 
 import (
-	"time"
 	"github.com/google/uuid"
+	"time"
 )
 
 type PaymentStatus string
@@ -12,24 +12,56 @@ const (
 	PaymentStatusProcessing PaymentStatus = "processing"
 	PaymentStatusCompleted  PaymentStatus = "completed"
 	PaymentStatusFailed     PaymentStatus = "failed"
+	PaymentStatusCancelled  PaymentStatus = "cancelled"
+)
+
+// FailureReason records why a payment was marked failed, so the DLQ re-drive
+// can leave out the failures another attempt wouldn't fix.
+type FailureReason string
+
+const (
+	FailureReasonTransient FailureReason = "transient"
+	FailureReasonRejected  FailureReason = "rejected"
+	FailureReasonExpired   FailureReason = "expired"
+	FailureReasonMaxAge    FailureReason = "max_age"
 )
 
 type Payment struct {
-	ID            uuid.UUID     `json:"id" db:"id"`
-	CorrelationID uuid.UUID     `json:"correlationId" db:"correlation_id"`
-	Amount        float64       `json:"amount" db:"amount"`
-	Fee           *float64      `json:"fee,omitempty" db:"fee"`
-	ProcessorType *string       `json:"processorType,omitempty" db:"processor_type"`
+	ID             uuid.UUID     `json:"id" db:"id"`
+	CorrelationID  uuid.UUID     `json:"correlationId" db:"correlation_id"`
+	Amount         Money         `json:"amount" db:"amount"`
+	Currency       string        `json:"currency" db:"currency"`
+	OriginalAmount Money         `json:"originalAmount" db:"original_amount"`
+	TenantID       *string       `json:"tenantId,omitempty" db:"tenant_id"`
+	OwnerInstance  *string       `json:"ownerInstance,omitempty" db:"owner_instance"`
+	CallbackURL    *string       `json:"callbackUrl,omitempty" db:"callback_url"`
+	Fee            *Money        `json:"fee,omitempty" db:"fee"`
+	ProcessorType  *string       `json:"processorType,omitempty" db:"processor_type"`
+	LatencyMs      *int64        `json:"latencyMs,omitempty" db:"latency_ms"`
+	Status         PaymentStatus `json:"status" db:"status"`
+	RequestedAt    time.Time     `json:"requestedAt" db:"requested_at"`
+	ProcessedAt    *time.Time    `json:"processedAt,omitempty" db:"processed_at"`
+	CreatedAt      time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+// PaymentEvent is one entry of a payment's status history. Actor names what
+// made the change, e.g. "worker-3", "api" or "compensator".
+type PaymentEvent struct {
+	ID            int64         `json:"id" db:"id"`
+	PaymentID     uuid.UUID     `json:"paymentId" db:"payment_id"`
 	Status        PaymentStatus `json:"status" db:"status"`
-	RequestedAt   time.Time     `json:"requestedAt" db:"requested_at"`
-	ProcessedAt   *time.Time    `json:"processedAt,omitempty" db:"processed_at"`
+	Actor         string        `json:"actor" db:"actor"`
+	ProcessorType *string       `json:"processorType,omitempty" db:"processor_type"`
+	Error         *string       `json:"error,omitempty" db:"error"`
 	CreatedAt     time.Time     `json:"createdAt" db:"created_at"`
-	UpdatedAt     time.Time     `json:"updatedAt" db:"updated_at"`
 }
 
 type PaymentRequest struct {
 	CorrelationID uuid.UUID `json:"correlationId" validate:"required"`
-	Amount        float64   `json:"amount" validate:"required,gt=0"`
+	Amount        Money     `json:"amount" validate:"required,gt=0"`
+	Currency      string    `json:"currency,omitempty"`
+	CallbackURL   string    `json:"callbackUrl,omitempty"`
 }
 
 type PaymentResponse struct {
@@ -37,8 +69,21 @@ type PaymentResponse struct {
 }
 
 type ProcessorSummary struct {
-	TotalRequests int     `json:"totalRequests"`
-	TotalAmount   float64 `json:"totalAmount"`
+	TotalRequests int    `json:"totalRequests"`
+	TotalAmount   Money  `json:"totalAmount"`
+	TotalFee      *Money `json:"totalFee,omitempty"`
+	NetAmount     *Money `json:"netAmount,omitempty"`
 }
 
-type PaymentSummaryResponse map[string]ProcessorSummary
\ No newline at end of file
+type PaymentSummaryResponse map[string]ProcessorSummary
+
+// ProcessorStats aggregates the payments a processor completed, for judging
+// routing strategies on real fees and latencies. Latencies only cover
+// payments the processor was called for, not ones found already charged.
+type ProcessorStats struct {
+	Payments     int     `json:"payments"`
+	TotalFee     Money   `json:"totalFee"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	P50LatencyMs float64 `json:"p50LatencyMs"`
+	P95LatencyMs float64 `json:"p95LatencyMs"`
+}
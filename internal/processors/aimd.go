@@ -0,0 +1,95 @@
+package processors
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveMin = 1
+	defaultAdaptiveMax = 64
+	// aimdBackoff is the factor the limit is cut by on a failure
+	aimdBackoff = 0.5
+	// aimdDecreaseCooldown keeps a burst of failures from the same overload
+	// from cutting the limit more than once
+	aimdDecreaseCooldown = 100 * time.Millisecond
+)
+
+// aimd adapts the in-flight limit of one processor: each successful call
+// under the target latency adds 1/limit, so the limit grows by about one per
+// round of calls, and a timeout or server error halves it. Successes over the
+// target leave it unchanged.
+type aimd struct {
+	target   time.Duration
+	min, max int
+
+	mu           sync.Mutex
+	window       float64
+	lastDecrease time.Time
+}
+
+// adaptiveFromEnv reads PROCESSOR_ADAPTIVE_TARGET_LATENCY, which enables the
+// controller, and PROCESSOR_ADAPTIVE_MIN (1). max is the processor's static
+// in-flight limit, or PROCESSOR_ADAPTIVE_MAX (64) without one. It returns
+// nil when disabled.
+func adaptiveFromEnv(max int) *aimd {
+	target := envDuration("PROCESSOR_ADAPTIVE_TARGET_LATENCY", 0)
+	if target == 0 {
+		return nil
+	}
+
+	min := envInt("PROCESSOR_ADAPTIVE_MIN", defaultAdaptiveMin)
+	if min < 1 {
+		min = 1
+	}
+	if max <= 0 {
+		max = envInt("PROCESSOR_ADAPTIVE_MAX", defaultAdaptiveMax)
+	}
+	if max < min {
+		max = min
+	}
+
+	return &aimd{target: target, min: min, max: max, window: float64(max)}
+}
+
+// limit returns the current in-flight limit.
+func (a *aimd) limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.window)
+}
+
+// observe records the outcome of a call and returns the new limit, and
+// whether it changed.
+func (a *aimd) observe(latency time.Duration, err error) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	before := int(a.window)
+	switch {
+	case err == nil:
+		if latency <= a.target {
+			a.window = min(a.window+1/a.window, float64(a.max))
+		}
+	case congested(err):
+		if time.Since(a.lastDecrease) >= aimdDecreaseCooldown {
+			a.window = max(a.window*aimdBackoff, float64(a.min))
+			a.lastDecrease = time.Now()
+		}
+	}
+
+	after := int(a.window)
+	return after, after != before
+}
+
+// congested reports whether a failed call signals an overloaded processor:
+// a timeout, a 5xx or a 429. Rejections of the payment itself don't.
+func congested(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return ClassifyError(err) == ErrorClassTimeout
+}
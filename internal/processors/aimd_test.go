@@ -0,0 +1,46 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAIMDAdjustsLimit(t *testing.T) {
+	a := &aimd{target: 100 * time.Millisecond, min: 2, max: 10, window: 4}
+
+	// About one more slot per round of fast successes
+	for i := 0; i < 4; i++ {
+		a.observe(10*time.Millisecond, nil)
+	}
+	if got := a.limit(); got != 4 && got != 5 {
+		t.Fatalf("expected the limit to grow by about one, got %d", got)
+	}
+	for i := 0; i < 100; i++ {
+		a.observe(10*time.Millisecond, nil)
+	}
+	if got := a.limit(); got != 10 {
+		t.Fatalf("expected the limit capped at 10, got %d", got)
+	}
+
+	if _, changed := a.observe(time.Second, nil); changed {
+		t.Error("expected a slow success to leave the limit alone")
+	}
+	if limit, changed := a.observe(0, &StatusError{StatusCode: http.StatusUnprocessableEntity}); changed {
+		t.Errorf("expected a rejection to leave the limit alone, got %d", limit)
+	}
+
+	if limit, _ := a.observe(0, &StatusError{StatusCode: http.StatusInternalServerError}); limit != 5 {
+		t.Fatalf("expected a 500 to halve the limit to 5, got %d", limit)
+	}
+	if limit, _ := a.observe(0, context.DeadlineExceeded); limit != 5 {
+		t.Fatalf("expected failures within the cooldown to be ignored, got %d", limit)
+	}
+	a.lastDecrease = time.Now().Add(-aimdDecreaseCooldown)
+	a.observe(0, context.DeadlineExceeded)
+	a.lastDecrease = time.Now().Add(-aimdDecreaseCooldown)
+	if limit, _ := a.observe(0, context.DeadlineExceeded); limit != 2 {
+		t.Fatalf("expected the limit floored at 2, got %d", limit)
+	}
+}
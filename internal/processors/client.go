@@ -4,51 +4,84 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
 )
 
 type ProcessorType string
 
+// maxDiscardedBody is how much of an error response is read so its
+// connection can go back to the pool; longer bodies close the connection.
+const maxDiscardedBody = 4 << 10
+
+// correlationIDHeader carries the payment's correlationId on every processor
+// call so the processors' logs can be matched with ours.
+const correlationIDHeader = "X-Correlation-Id"
+
 const (
 	ProcessorTypeDefault  ProcessorType = "default"
 	ProcessorTypeFallback ProcessorType = "fallback"
 )
 
 type PaymentProcessorRequest struct {
-	CorrelationID uuid.UUID `json:"correlationId"`
-	Amount        float64   `json:"amount"`
-	RequestedAt   string    `json:"requestedAt"`
+	CorrelationID uuid.UUID    `json:"correlationId"`
+	Amount        models.Money `json:"amount"`
+	RequestedAt   string       `json:"requestedAt"`
 }
 
 type PaymentProcessorResponse struct {
 	Message string `json:"message"`
 }
 
+type PaymentDetailsResponse struct {
+	CorrelationID uuid.UUID    `json:"correlationId"`
+	Amount        models.Money `json:"amount"`
+	RequestedAt   string       `json:"requestedAt"`
+}
+
+var ErrPaymentNotFound = errors.New("payment not found on processor")
+
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status          string `json:"status"`
+	Failing         bool   `json:"failing"`
+	MinResponseTime int    `json:"minResponseTime"`
 }
 
 type Client struct {
-	httpClient  *http.Client
-	defaultURL  string
-	fallbackURL string
+	httpClient *http.Client
+	urls       map[ProcessorType]string
+	timeouts   Timeouts
 }
 
-func NewClient(defaultURL, fallbackURL string) *Client {
+// NewClient builds a client for the configured processors whose calls are
+// bounded by the timeouts from TimeoutsFromEnv rather than a single
+// client-wide timeout.
+func NewClient(configs []Config) *Client {
+	urls := make(map[ProcessorType]string, len(configs))
+	names := make([]ProcessorType, len(configs))
+	for i, c := range configs {
+		urls[c.Name] = c.URL
+		names[i] = c.Name
+	}
+
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Transport: newTransport(len(configs)),
 		},
-		defaultURL:  defaultURL,
-		fallbackURL: fallbackURL,
+		urls:     urls,
+		timeouts: TimeoutsFromEnv(names),
 	}
 }
 
 func (c *Client) ProcessPayment(ctx context.Context, req PaymentProcessorRequest, processorType ProcessorType) (*PaymentProcessorResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.payment(processorType))
+	defer cancel()
+	
 	url := c.getProcessorURL(processorType)
 	
 	jsonData, err := json.Marshal(req)
@@ -62,6 +95,7 @@ func (c *Client) ProcessPayment(ctx context.Context, req PaymentProcessorRequest
 	}
 	
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(correlationIDHeader, req.CorrelationID.String())
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -69,12 +103,9 @@ func (c *Client) ProcessPayment(ctx context.Context, req PaymentProcessorRequest
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 500 {
-		return nil, fmt.Errorf("%s processor returned server error: %d", processorType, resp.StatusCode)
-	}
-	
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s processor returned error: %d", processorType, resp.StatusCode)
+		discardBody(resp)
+		return nil, &StatusError{Processor: processorType, StatusCode: resp.StatusCode}
 	}
 
 	var processorResp PaymentProcessorResponse
@@ -91,6 +122,9 @@ func (c *Client) ProcessPayment(ctx context.Context, req PaymentProcessorRequest
 }
 
 func (c *Client) CheckHealth(ctx context.Context, processorType ProcessorType) (*HealthResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Health)
+	defer cancel()
+	
 	url := c.getProcessorURL(processorType)
 	
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url+"/payments/service-health", nil)
@@ -105,6 +139,7 @@ func (c *Client) CheckHealth(ctx context.Context, processorType ProcessorType) (
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		discardBody(resp)
 		return nil, fmt.Errorf("%s processor health check returned error: %d", processorType, resp.StatusCode)
 	}
 
@@ -116,13 +151,46 @@ func (c *Client) CheckHealth(ctx context.Context, processorType ProcessorType) (
 	return &healthResp, nil
 }
 
-func (c *Client) getProcessorURL(processorType ProcessorType) string {
-	switch processorType {
-	case ProcessorTypeDefault:
-		return c.defaultURL
-	case ProcessorTypeFallback:
-		return c.fallbackURL
-	default:
-		return c.defaultURL
+func (c *Client) GetPayment(ctx context.Context, correlationID uuid.UUID, processorType ProcessorType) (*PaymentDetailsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Lookup)
+	defer cancel()
+
+	url := c.getProcessorURL(processorType)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url+"/payments/"+correlationID.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment details request: %w", err)
 	}
+	httpReq.Header.Set(correlationIDHeader, correlationID.String())
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment details from %s processor: %w", processorType, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		discardBody(resp)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, fmt.Errorf("%s processor payment details returned error: %d", processorType, resp.StatusCode)
+	}
+
+	var detailsResp PaymentDetailsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&detailsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode payment details from %s processor: %w", processorType, err)
+	}
+
+	return &detailsResp, nil
+}
+
+func (c *Client) getProcessorURL(processorType ProcessorType) string {
+	return c.urls[processorType]
+}
+
+// discardBody drains what is left of a response nobody will decode, so the
+// keep-alive connection is reused instead of closed.
+func discardBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDiscardedBody))
 }
\ No newline at end of file
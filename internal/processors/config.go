@@ -0,0 +1,73 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxProcessorNameLength matches payments.processor_type.
+const maxProcessorNameLength = 20
+
+// Config describes a payment processor. Name is also the key it gets in the
+// payments summary. Processors are tried in ascending Priority by the
+// failover strategy; FeeRate is the fraction of the amount it charges.
+type Config struct {
+	Name     ProcessorType `json:"name"`
+	URL      string        `json:"url"`
+	FeeRate  float64       `json:"fee"`
+	Priority int           `json:"priority"`
+}
+
+// DefaultConfigs returns the two processors of the contest.
+func DefaultConfigs(defaultURL, fallbackURL string) []Config {
+	return []Config{
+		{Name: ProcessorTypeDefault, URL: defaultURL, FeeRate: 0.03, Priority: 0},
+		{Name: ProcessorTypeFallback, URL: fallbackURL, FeeRate: 0.05, Priority: 1},
+	}
+}
+
+// ConfigsFromEnv parses PAYMENT_PROCESSORS, a JSON array of Config, sorted by
+// priority. Without it the default and fallback processors are used at the
+// given URLs.
+func ConfigsFromEnv(defaultURL, fallbackURL string) ([]Config, error) {
+	raw := strings.TrimSpace(os.Getenv("PAYMENT_PROCESSORS"))
+	if raw == "" {
+		return DefaultConfigs(defaultURL, fallbackURL), nil
+	}
+
+	var configs []Config
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid PAYMENT_PROCESSORS: %w", err)
+	}
+	if err := validateConfigs(configs); err != nil {
+		return nil, fmt.Errorf("invalid PAYMENT_PROCESSORS: %w", err)
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool { return configs[i].Priority < configs[j].Priority })
+	return configs, nil
+}
+
+func validateConfigs(configs []Config) error {
+	if len(configs) == 0 {
+		return fmt.Errorf("no processors configured")
+	}
+
+	seen := make(map[ProcessorType]bool, len(configs))
+	for _, c := range configs {
+		switch {
+		case c.Name == "" || len(c.Name) > maxProcessorNameLength:
+			return fmt.Errorf("processor name %q must have 1 to %d characters", c.Name, maxProcessorNameLength)
+		case seen[c.Name]:
+			return fmt.Errorf("processor %q configured twice", c.Name)
+		case c.URL == "":
+			return fmt.Errorf("processor %q has no url", c.Name)
+		case c.FeeRate < 0 || c.FeeRate >= 1:
+			return fmt.Errorf("processor %q fee must be between 0 and 1", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return nil
+}
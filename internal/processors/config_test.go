@@ -0,0 +1,43 @@
+package processors
+
+import "testing"
+
+func TestConfigsFromEnv(t *testing.T) {
+	t.Setenv("PAYMENT_PROCESSORS", `[
+		{"name": "backup", "url": "http://backup:8080", "fee": 0.05, "priority": 2},
+		{"name": "primary", "url": "http://primary:8080", "fee": 0.02, "priority": 0},
+		{"name": "spare", "url": "http://spare:8080", "fee": 0.04, "priority": 1}
+	]`)
+
+	configs, err := ConfigsFromEnv("http://default", "http://fallback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ProcessorType{"primary", "spare", "backup"}
+	for i, c := range configs {
+		if c.Name != want[i] {
+			t.Fatalf("expected processors in priority order %v, got %v", want, configs)
+		}
+	}
+
+	ps := NewProcessorService(configs)
+	if got := ps.FeeRate("primary"); got != 0.02 {
+		t.Errorf("expected fee 0.02, got %v", got)
+	}
+	if got := ps.cheapestProcessor(); got != "primary" {
+		t.Errorf("expected primary to be the cheapest, got %s", got)
+	}
+
+	for _, raw := range []string{
+		`[]`,
+		`[{"name": "a", "url": "http://a"}, {"name": "a", "url": "http://b"}]`,
+		`[{"name": "a"}]`,
+		`[{"name": "a", "url": "http://a", "fee": 1.5}]`,
+		`not json`,
+	} {
+		t.Setenv("PAYMENT_PROCESSORS", raw)
+		if _, err := ConfigsFromEnv("http://default", "http://fallback"); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package processors
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailbackInterval  = time.Second
+	defaultFailbackSuccesses = 3
+)
+
+// failback sends a live payment to the cheapest processor at most once per
+// interval while it is marked unhealthy. After enough consecutive successes
+// it is marked healthy again, so traffic leaves the pricier processor without
+// waiting for the rate-limited health check.
+type failback struct {
+	interval  time.Duration
+	successes int
+
+	mu        sync.Mutex
+	lastProbe time.Time
+	streak    int
+}
+
+// failbackFromEnv reads PROCESSOR_FAILBACK_INTERVAL (1s, 0 disables) and
+// PROCESSOR_FAILBACK_SUCCESSES (3). It returns nil when disabled.
+func failbackFromEnv() *failback {
+	interval := defaultFailbackInterval
+	if raw := os.Getenv("PROCESSOR_FAILBACK_INTERVAL"); raw != "" {
+		if v, err := time.ParseDuration(raw); err == nil && v >= 0 {
+			interval = v
+		}
+	}
+	if interval == 0 {
+		return nil
+	}
+
+	successes := defaultFailbackSuccesses
+	if v, err := strconv.Atoi(os.Getenv("PROCESSOR_FAILBACK_SUCCESSES")); err == nil && v > 0 {
+		successes = v
+	}
+
+	return &failback{interval: interval, successes: successes}
+}
+
+// due reports whether a probe may go out now, claiming the slot if so.
+func (f *failback) due() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.lastProbe) < f.interval {
+		return false
+	}
+	f.lastProbe = time.Now()
+	return true
+}
+
+// record counts a probe outcome and reports whether the streak is complete,
+// starting a new one if so.
+func (f *failback) record(ok bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !ok {
+		f.streak = 0
+		return false
+	}
+	f.streak++
+	if f.streak < f.successes {
+		return false
+	}
+	f.streak = 0
+	return true
+}
+
+// cheapestProcessor is the processor fail-back steers traffic towards.
+func (ps *ProcessorService) cheapestProcessor() ProcessorType {
+	cheapest := ps.processors[0]
+	for _, processorType := range ps.processors[1:] {
+		if ps.FeeRate(processorType) < ps.FeeRate(cheapest) {
+			cheapest = processorType
+		}
+	}
+	return cheapest
+}
+
+// moveToFront returns order with processorType first.
+func moveToFront(order []ProcessorType, processorType ProcessorType) []ProcessorType {
+	moved := make([]ProcessorType, 0, len(order))
+	moved = append(moved, processorType)
+	for _, p := range order {
+		if p != processorType {
+			moved = append(moved, p)
+		}
+	}
+	return moved
+}
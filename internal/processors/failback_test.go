@@ -0,0 +1,44 @@
+package processors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFailbackNeedsConsecutiveSuccesses(t *testing.T) {
+	f := &failback{interval: time.Hour, successes: 3}
+
+	if !f.due() {
+		t.Fatal("expected the first probe to be due")
+	}
+	if f.due() {
+		t.Fatal("expected a second probe within the interval to wait")
+	}
+
+	outcomes := []bool{true, true, false, true, true}
+	for i, ok := range outcomes {
+		if f.record(ok) {
+			t.Fatalf("probe #%d: fail-back before 3 consecutive successes", i+1)
+		}
+	}
+	if !f.record(true) {
+		t.Fatal("expected fail-back after 3 consecutive successes")
+	}
+	if f.record(true) {
+		t.Fatal("expected the streak to start over after failing back")
+	}
+}
+
+func TestFailbackProbesCheapestFirst(t *testing.T) {
+	ps := NewProcessorService(DefaultConfigs("http://default", "http://fallback"))
+	if got := ps.cheapestProcessor(); got != ProcessorTypeDefault {
+		t.Fatalf("expected the default processor to be the cheapest, got %s", got)
+	}
+
+	order := []ProcessorType{ProcessorTypeFallback, ProcessorTypeDefault}
+	want := []ProcessorType{ProcessorTypeDefault, ProcessorTypeFallback}
+	if got := moveToFront(order, ProcessorTypeDefault); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,67 @@
+package processors
+
+import (
+	"sync"
+	"time"
+)
+
+// healthHistorySize is how many recent health checks are kept per processor.
+const healthHistorySize = 20
+
+// HealthCheck is the outcome of one health-check call.
+type HealthCheck struct {
+	At                time.Time `json:"at"`
+	Healthy           bool      `json:"healthy"`
+	LatencyMs         float64   `json:"latencyMs"`
+	MinResponseTimeMs int       `json:"minResponseTimeMs"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// ProcessorHealthHistory is what GET /admin/processors/health reports for one
+// processor. Checks are oldest first.
+type ProcessorHealthHistory struct {
+	LastLatencyMs float64       `json:"lastLatencyMs"`
+	Checks        []HealthCheck `json:"checks"`
+}
+
+// healthHistory is a ring buffer of the latest health checks of one processor.
+type healthHistory struct {
+	mu     sync.Mutex
+	checks [healthHistorySize]HealthCheck
+	next   int
+	count  int
+}
+
+func (h *healthHistory) add(check HealthCheck) {
+	h.mu.Lock()
+	h.checks[h.next] = check
+	h.next = (h.next + 1) % len(h.checks)
+	if h.count < len(h.checks) {
+		h.count++
+	}
+	h.mu.Unlock()
+}
+
+func (h *healthHistory) snapshot() ProcessorHealthHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history := ProcessorHealthHistory{Checks: make([]HealthCheck, 0, h.count)}
+	start := (h.next - h.count + len(h.checks)) % len(h.checks)
+	for i := 0; i < h.count; i++ {
+		history.Checks = append(history.Checks, h.checks[(start+i)%len(h.checks)])
+	}
+	if h.count > 0 {
+		history.LastLatencyMs = history.Checks[h.count-1].LatencyMs
+	}
+	return history
+}
+
+// HealthHistory returns the recent health checks of every processor.
+func (ps *ProcessorService) HealthHistory() map[ProcessorType]ProcessorHealthHistory {
+	histories := make(map[ProcessorType]ProcessorHealthHistory, len(ps.healthHistory))
+	for processorType, history := range ps.healthHistory {
+		histories[processorType] = history.snapshot()
+	}
+	return histories
+}
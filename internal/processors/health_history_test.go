@@ -0,0 +1,25 @@
+package processors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthHistoryKeepsLatestChecks(t *testing.T) {
+	var h healthHistory
+	start := time.Now()
+	for i := 0; i < healthHistorySize+5; i++ {
+		h.add(HealthCheck{At: start.Add(time.Duration(i) * time.Second), LatencyMs: float64(i)})
+	}
+
+	history := h.snapshot()
+	if len(history.Checks) != healthHistorySize {
+		t.Fatalf("expected %d checks, got %d", healthHistorySize, len(history.Checks))
+	}
+	if history.Checks[0].LatencyMs != 5 {
+		t.Errorf("expected the oldest kept check to be #5, got #%v", history.Checks[0].LatencyMs)
+	}
+	if want := float64(healthHistorySize + 4); history.LastLatencyMs != want {
+		t.Errorf("expected last latency %v, got %v", want, history.LastLatencyMs)
+	}
+}
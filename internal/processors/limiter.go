@@ -0,0 +1,67 @@
+package processors
+
+import (
+	"context"
+	"sync"
+)
+
+// limiter is a semaphore bounding the payments in flight to one processor.
+// Its limit can change while it is in use; a limit of zero means unlimited.
+type limiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	// freed is closed and replaced whenever a slot frees up or the limit
+	// changes, waking the callers waiting in acquire
+	freed chan struct{}
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire waits for a free slot or for ctx to be done.
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.limit <= 0 || l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.wakeLocked()
+	l.mu.Unlock()
+}
+
+func (l *limiter) setLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.wakeLocked()
+	l.mu.Unlock()
+}
+
+// usage returns the payments in flight and the current limit.
+func (l *limiter) usage() (inFlight, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, l.limit
+}
+
+func (l *limiter) wakeLocked() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,44 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterBoundsInFlight(t *testing.T) {
+	l := newLimiter(2)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected acquire to wait past the limit, got %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(ctx) }()
+	l.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a release to wake a waiting caller")
+	}
+
+	l.setLimit(0)
+	if err := l.acquire(ctx); err != nil {
+		t.Fatalf("expected no limit once set to zero, got %v", err)
+	}
+	if inFlight, limit := l.usage(); inFlight != 3 || limit != 0 {
+		t.Errorf("expected 3 in flight without a limit, got %d of %d", inFlight, limit)
+	}
+}
@@ -0,0 +1,150 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MockProcessor is an in-memory Processor for tests. Every processor accepts
+// payments unless told otherwise: Script queues the outcome of its next
+// calls, SetFailing makes it fail every call and report failing health once
+// the script runs out, and SetLatency delays each call, honouring the
+// context. Accepted payments can be looked up with GetPayment.
+type MockProcessor struct {
+	mu       sync.Mutex
+	latency  map[ProcessorType]time.Duration
+	failing  map[ProcessorType]bool
+	script   map[ProcessorType][]error
+	payments map[uuid.UUID]mockPayment
+	calls    map[ProcessorType]int
+}
+
+type mockPayment struct {
+	processorType ProcessorType
+	req           PaymentProcessorRequest
+}
+
+func NewMockProcessor() *MockProcessor {
+	return &MockProcessor{
+		latency:  make(map[ProcessorType]time.Duration),
+		failing:  make(map[ProcessorType]bool),
+		script:   make(map[ProcessorType][]error),
+		payments: make(map[uuid.UUID]mockPayment),
+		calls:    make(map[ProcessorType]int),
+	}
+}
+
+// SetLatency delays every call to the processor by d.
+func (m *MockProcessor) SetLatency(processorType ProcessorType, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency[processorType] = d
+}
+
+// SetFailing makes unscripted payments to the processor fail with a 500 and
+// its health check report failing.
+func (m *MockProcessor) SetFailing(processorType ProcessorType, failing bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failing[processorType] = failing
+}
+
+// Script queues the outcomes of the next payments sent to the processor, nil
+// meaning success. For example Script(p, MockUnavailable, MockUnavailable, nil)
+// fails twice and then accepts the payment.
+func (m *MockProcessor) Script(processorType ProcessorType, outcomes ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.script[processorType] = append(m.script[processorType], outcomes...)
+}
+
+// Calls returns how many payments were sent to the processor.
+func (m *MockProcessor) Calls(processorType ProcessorType) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[processorType]
+}
+
+var (
+	// MockUnavailable is a transient failure, as a 500 from the processor.
+	MockUnavailable = &StatusError{StatusCode: http.StatusInternalServerError}
+	// MockRejected is a rejection, as a 422 from the processor.
+	MockRejected = &StatusError{StatusCode: http.StatusUnprocessableEntity}
+	// MockTimedOut accepts the payment but fails the call with
+	// context.DeadlineExceeded, as a response lost on its way back.
+	MockTimedOut = errors.New("mock: accepted but timed out")
+)
+
+func (m *MockProcessor) ProcessPayment(ctx context.Context, req PaymentProcessorRequest, processorType ProcessorType) (*PaymentProcessorResponse, error) {
+	m.mu.Lock()
+	m.calls[processorType]++
+	var err error
+	if script := m.script[processorType]; len(script) > 0 {
+		err, m.script[processorType] = script[0], script[1:]
+	} else if m.failing[processorType] {
+		err = MockUnavailable
+	}
+	latency := m.latency[processorType]
+	m.mu.Unlock()
+
+	if waitErr := m.wait(ctx, latency); waitErr != nil {
+		return nil, waitErr
+	}
+	if err != nil && err != MockTimedOut {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.payments[req.CorrelationID] = mockPayment{processorType: processorType, req: req}
+	m.mu.Unlock()
+	if err == MockTimedOut {
+		return nil, context.DeadlineExceeded
+	}
+	return &PaymentProcessorResponse{Message: "payment processed successfully"}, nil
+}
+
+func (m *MockProcessor) CheckHealth(ctx context.Context, processorType ProcessorType) (*HealthResponse, error) {
+	m.mu.Lock()
+	latency := m.latency[processorType]
+	failing := m.failing[processorType]
+	m.mu.Unlock()
+
+	if err := m.wait(ctx, latency); err != nil {
+		return nil, err
+	}
+	return &HealthResponse{Failing: failing, MinResponseTime: int(latency / time.Millisecond)}, nil
+}
+
+func (m *MockProcessor) GetPayment(ctx context.Context, correlationID uuid.UUID, processorType ProcessorType) (*PaymentDetailsResponse, error) {
+	m.mu.Lock()
+	payment, ok := m.payments[correlationID]
+	m.mu.Unlock()
+
+	if !ok || payment.processorType != processorType {
+		return nil, ErrPaymentNotFound
+	}
+	return &PaymentDetailsResponse{
+		CorrelationID: payment.req.CorrelationID,
+		Amount:        payment.req.Amount,
+		RequestedAt:   payment.req.RequestedAt,
+	}, nil
+}
+
+func (m *MockProcessor) wait(ctx context.Context, latency time.Duration) error {
+	if latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
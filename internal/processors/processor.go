@@ -0,0 +1,17 @@
+package processors
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Processor is the API of the payment processors as ProcessorService uses
+// it. Client implements it over HTTP and MockProcessor in memory.
+type Processor interface {
+	ProcessPayment(ctx context.Context, req PaymentProcessorRequest, processorType ProcessorType) (*PaymentProcessorResponse, error)
+	CheckHealth(ctx context.Context, processorType ProcessorType) (*HealthResponse, error)
+	GetPayment(ctx context.Context, correlationID uuid.UUID, processorType ProcessorType) (*PaymentDetailsResponse, error)
+}
+
+var _ Processor = (*Client)(nil)
@@ -0,0 +1,163 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// StatusError is returned when a processor answers with a non-200 status.
+type StatusError struct {
+	Processor  ProcessorType
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	if e.StatusCode >= 500 {
+		return fmt.Sprintf("%s processor returned server error: %d", e.Processor, e.StatusCode)
+	}
+	return fmt.Sprintf("%s processor returned error: %d", e.Processor, e.StatusCode)
+}
+
+// ErrorClass groups processor errors by how they should be retried.
+type ErrorClass string
+
+const (
+	// ErrorClassTransient covers 5xx, 429 and connection errors.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassTimeout means the call may or may not have reached the processor.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassRejected is a 4xx: the processor refused the request itself,
+	// so neither a retry nor the other processor will do better.
+	ErrorClassRejected ErrorClass = "rejected"
+)
+
+func ClassifyError(err error) ErrorClass {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests {
+			return ErrorClassRejected
+		}
+		return ErrorClassTransient
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorClassTimeout
+	}
+	return ErrorClassTransient
+}
+
+// errNotSent marks a call that failed before the request went out.
+var errNotSent = errors.New("payment request not sent")
+
+// neverCharged reports whether a failed call certainly left the payment
+// uncharged: the processor answered with an error status or the request
+// never went out. A timeout or a connection dropped mid-request may not have.
+func neverCharged(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) || errors.Is(err, errNotSent) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// RetryPolicy controls the retries of a payment against one processor.
+type RetryPolicy struct {
+	MaxAttempts    int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	Backoff        float64
+	Jitter         float64 // fraction of the delay randomized, 0 to 1
+	RetryOnTimeout bool
+}
+
+// RetryPolicyFromEnv reads PROCESSOR_RETRY_MAX_ATTEMPTS (3),
+// PROCESSOR_RETRY_BASE_DELAY (100ms), PROCESSOR_RETRY_MAX_DELAY (1s),
+// PROCESSOR_RETRY_BACKOFF (2), PROCESSOR_RETRY_JITTER (0) and
+// PROCESSOR_RETRY_ON_TIMEOUT (true).
+func RetryPolicyFromEnv() RetryPolicy {
+	return RetryPolicyFrom(os.Getenv)
+}
+
+// RetryPolicyFrom reads the PROCESSOR_RETRY_* settings through getenv, with
+// the defaults of RetryPolicyFromEnv.
+func RetryPolicyFrom(getenv func(string) string) RetryPolicy {
+	p := RetryPolicy{
+		MaxAttempts:    3,
+		BaseDelay:      100 * time.Millisecond,
+		MaxDelay:       time.Second,
+		Backoff:        2,
+		RetryOnTimeout: true,
+	}
+	if v, err := strconv.Atoi(getenv("PROCESSOR_RETRY_MAX_ATTEMPTS")); err == nil && v >= 0 {
+		p.MaxAttempts = max(v, 1)
+	}
+	if v, err := time.ParseDuration(getenv("PROCESSOR_RETRY_BASE_DELAY")); err == nil && v > 0 {
+		p.BaseDelay = v
+	}
+	if v, err := time.ParseDuration(getenv("PROCESSOR_RETRY_MAX_DELAY")); err == nil && v > 0 {
+		p.MaxDelay = v
+	}
+	if v, err := strconv.ParseFloat(getenv("PROCESSOR_RETRY_BACKOFF"), 64); err == nil && v >= 1 {
+		p.Backoff = v
+	}
+	if v, err := strconv.ParseFloat(getenv("PROCESSOR_RETRY_JITTER"), 64); err == nil && v >= 0 && v <= 1 {
+		p.Jitter = v
+	}
+	if v, err := strconv.ParseBool(getenv("PROCESSOR_RETRY_ON_TIMEOUT")); err == nil {
+		p.RetryOnTimeout = v
+	}
+	return p
+}
+
+// Delay returns the wait before retry number attempt (1 for the first retry).
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(p.Backoff, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Retryable reports whether an error of class is worth another attempt.
+func (p RetryPolicy) Retryable(class ErrorClass) bool {
+	switch class {
+	case ErrorClassRejected:
+		return false
+	case ErrorClassTimeout:
+		return p.RetryOnTimeout
+	default:
+		return true
+	}
+}
+
+// ErrRetryDeadline is returned instead of starting another attempt once the
+// deadline set with WithRetryDeadline has passed.
+var ErrRetryDeadline = errors.New("payment retry deadline exceeded")
+
+type retryDeadlineKey struct{}
+
+// WithRetryDeadline stops retries and fallbacks that would start after
+// deadline. Unlike a context deadline it never interrupts a call in flight.
+func WithRetryDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, retryDeadlineKey{}, deadline)
+}
+
+// retryAllowed reports whether an attempt starting after wait is still
+// within the retry deadline of ctx, if any.
+func retryAllowed(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Value(retryDeadlineKey{}).(time.Time)
+	return !ok || time.Now().Add(wait).Before(deadline)
+}
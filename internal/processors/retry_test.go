@@ -0,0 +1,59 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&StatusError{Processor: ProcessorTypeDefault, StatusCode: 500}, ErrorClassTransient},
+		{&StatusError{Processor: ProcessorTypeDefault, StatusCode: 429}, ErrorClassTransient},
+		{fmt.Errorf("wrapped: %w", &StatusError{Processor: ProcessorTypeDefault, StatusCode: 422}), ErrorClassRejected},
+		{fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), ErrorClassTimeout},
+		{fmt.Errorf("connection refused"), ErrorClassTransient},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond, Backoff: 2}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond} {
+		if got := p.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered Delay(1) = %v, want within [50ms, 100ms]", got)
+		}
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	ctx := context.Background()
+	if !retryAllowed(ctx, time.Hour) {
+		t.Error("expected retries to be allowed without a deadline")
+	}
+
+	ctx = WithRetryDeadline(ctx, time.Now().Add(time.Second))
+	if !retryAllowed(ctx, 0) {
+		t.Error("expected an immediate attempt to be allowed before the deadline")
+	}
+	if retryAllowed(ctx, time.Minute) {
+		t.Error("expected an attempt after the deadline to be refused")
+	}
+}
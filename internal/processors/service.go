@@ -2,66 +2,332 @@ package processors
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand/v2"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"rinha-backend-2025/internal/metrics"
+	"rinha-backend-2025/internal/models"
+)
+
+// healthCheckJitter spreads health checks so instances started together
+// don't hit the rate-limited health endpoint in lockstep.
+const healthCheckJitter = time.Second
+
+// latencySmoothing is the weight of the newest sample in the per-processor
+// latency moving average.
+const latencySmoothing = 0.2
+
+const (
+	callLatencyWindow     = time.Minute
+	callLatencyMaxSamples = 10000
 )
 
 type ProcessorService struct {
-	client            *Client
+	client            Processor
+	// processors are the configured processor names in priority order
+	processors        []ProcessorType
+	feeRates          map[ProcessorType]float64
+	// limiters bound the payments in flight to each processor; adaptive,
+	// when enabled, tunes their limits from the outcome of each call
+	limiters          map[ProcessorType]*limiter
+	adaptive          map[ProcessorType]*aimd
+	// strategy and retryPolicy can be swapped at runtime by Reload
+	configMutex       sync.RWMutex
+	strategy          Strategy
+	retryPolicy       RetryPolicy
 	healthCache       map[ProcessorType]bool
 	healthCacheMutex  sync.RWMutex
-	lastHealthCheck   map[ProcessorType]time.Time
+	nextHealthCheck   map[ProcessorType]time.Time
+	healthChecking    map[ProcessorType]bool
+	minResponseTime   map[ProcessorType]int
 	healthCheckCooldown time.Duration
+	// slowThreshold demotes a processor whose reported minResponseTime
+	// exceeds it below the healthy, fast ones. Zero disables it.
+	slowThreshold     time.Duration
+	latencyMs         map[ProcessorType]float64
+	latencyMutex      sync.Mutex
+	// callLatency keeps the raw samples behind the percentiles in /admin/stats
+	callLatency   map[ProcessorType]*metrics.LatencyTracker
+	healthHistory map[ProcessorType]*healthHistory
+	// failback probes the cheapest processor while it is unhealthy; nil
+	// when disabled
+	failback *failback
 }
 
-func NewProcessorService(defaultURL, fallbackURL string) *ProcessorService {
+func NewProcessorService(configs []Config) *ProcessorService {
+	return NewProcessorServiceWith(configs, NewClient(configs))
+}
+
+// NewProcessorServiceWith routes payments through processor instead of the
+// HTTP client, e.g. a MockProcessor in tests. Only the names and fees of
+// configs are used.
+func NewProcessorServiceWith(configs []Config, processor Processor) *ProcessorService {
+	strategy, err := NewStrategy(os.Getenv("PROCESSOR_STRATEGY"))
+	if err != nil {
+		slog.Warn("ignoring PROCESSOR_STRATEGY", "error", err)
+		strategy = FailoverOnly{}
+	}
+
+	slowThreshold, _ := time.ParseDuration(os.Getenv("PROCESSOR_SLOW_THRESHOLD"))
+
+	processors := make([]ProcessorType, len(configs))
+	feeRates := make(map[ProcessorType]float64, len(configs))
+	callLatency := make(map[ProcessorType]*metrics.LatencyTracker, len(configs))
+	history := make(map[ProcessorType]*healthHistory, len(configs))
+	limiters := make(map[ProcessorType]*limiter, len(configs))
+	adaptive := make(map[ProcessorType]*aimd, len(configs))
+	maxInFlight := envInt("PROCESSOR_MAX_IN_FLIGHT", 0)
+	for i, c := range configs {
+		processors[i] = c.Name
+		feeRates[c.Name] = c.FeeRate
+		callLatency[c.Name] = metrics.NewLatencyTracker(callLatencyWindow, callLatencyMaxSamples)
+		history[c.Name] = &healthHistory{}
+		limit := envInt(processorEnv("PROCESSOR_MAX_IN_FLIGHT", c.Name), maxInFlight)
+		if controller := adaptiveFromEnv(limit); controller != nil {
+			adaptive[c.Name] = controller
+			limit = controller.limit()
+		}
+		limiters[c.Name] = newLimiter(limit)
+	}
+
 	return &ProcessorService{
-		client:              NewClient(defaultURL, fallbackURL),
+		client:              processor,
+		processors:          processors,
+		feeRates:            feeRates,
+		limiters:            limiters,
+		adaptive:            adaptive,
+		strategy:            strategy,
+		retryPolicy:         RetryPolicyFromEnv(),
 		healthCache:         make(map[ProcessorType]bool),
-		lastHealthCheck:     make(map[ProcessorType]time.Time),
+		nextHealthCheck:     make(map[ProcessorType]time.Time),
+		healthChecking:      make(map[ProcessorType]bool),
+		minResponseTime:     make(map[ProcessorType]int),
 		healthCheckCooldown: 5 * time.Second,
+		slowThreshold:       slowThreshold,
+		latencyMs:           make(map[ProcessorType]float64),
+		callLatency:         callLatency,
+		healthHistory:       history,
+		failback:            failbackFromEnv(),
+	}
+}
+
+// Processors returns the configured processors in priority order.
+func (ps *ProcessorService) Processors() []ProcessorType {
+	return ps.processors
+}
+
+// FeeRate returns the fee the processor charges on the payment amount.
+func (ps *ProcessorService) FeeRate(processorType ProcessorType) float64 {
+	return ps.feeRates[processorType]
+}
+
+// CallLatency returns the percentiles of recent successful payment calls to
+// each processor.
+func (ps *ProcessorService) CallLatency() map[ProcessorType]metrics.LatencySnapshot {
+	snapshots := make(map[ProcessorType]metrics.LatencySnapshot, len(ps.callLatency))
+	for processorType, tracker := range ps.callLatency {
+		snapshots[processorType] = tracker.Snapshot()
 	}
+	return snapshots
+}
+
+// Strategy returns the routing strategy in use.
+func (ps *ProcessorService) Strategy() Strategy {
+	ps.configMutex.RLock()
+	defer ps.configMutex.RUnlock()
+	return ps.strategy
+}
+
+func (ps *ProcessorService) RetryPolicy() RetryPolicy {
+	ps.configMutex.RLock()
+	defer ps.configMutex.RUnlock()
+	return ps.retryPolicy
+}
+
+// Reload switches to strategy and policy. Payments already being routed
+// finish with the previous settings.
+func (ps *ProcessorService) Reload(strategy Strategy, policy RetryPolicy) {
+	ps.configMutex.Lock()
+	ps.strategy = strategy
+	ps.retryPolicy = policy
+	ps.configMutex.Unlock()
+
+	slog.Info("reloaded processor settings", "strategy", strategy.Name(), "retryMaxAttempts", policy.MaxAttempts)
 }
 
-func (ps *ProcessorService) ProcessPaymentWithFallback(ctx context.Context, correlationID uuid.UUID, amount float64, requestedAt time.Time) (*PaymentProcessorResponse, ProcessorType, error) {
+func (ps *ProcessorService) ProcessPaymentWithFallback(ctx context.Context, correlationID uuid.UUID, amount models.Money, requestedAt time.Time) (*PaymentProcessorResponse, ProcessorType, error) {
 	req := PaymentProcessorRequest{
 		CorrelationID: correlationID,
 		Amount:        amount,
 		RequestedAt:   requestedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
 	}
 
-	processorOrder := []ProcessorType{ProcessorTypeDefault, ProcessorTypeFallback}
+	states := ps.states()
+	processorOrder := ps.Strategy().Order(states)
+	probe, probing := ps.failbackProbe(states)
+	if probing {
+		processorOrder = moveToFront(processorOrder, probe)
+	}
 	
+	var lastErr error
 	for _, processorType := range processorOrder {
-		if !ps.isProcessorHealthy(ctx, processorType) {
-			log.Printf("Processor %s is not healthy, skipping", processorType)
-			continue
+		if lastErr != nil && !retryAllowed(ctx, 0) {
+			return nil, processorType, fmt.Errorf("%w: %w", ErrRetryDeadline, lastErr)
 		}
 
-		resp, err := ps.processPaymentWithRetry(ctx, req, processorType)
+		start := time.Now()
+		var resp *PaymentProcessorResponse
+		var err error
+		if probing && processorType == probe {
+			// A single attempt: a failed probe moves on to the next
+			// processor, once it is sure the probe charged nothing
+			resp, err = ps.sendPayment(ctx, req, processorType)
+			ps.recordFailbackProbe(processorType, err == nil)
+			if err != nil && ClassifyError(err) != ErrorClassRejected {
+				if !neverCharged(err) {
+					found, verifyErr := ps.VerifyPayment(ctx, correlationID, processorType)
+					if verifyErr != nil {
+						slog.Warn("failed to verify fail-back probe", "processor", processorType, "correlationId", correlationID, "error", verifyErr)
+						return nil, processorType, fmt.Errorf("fail-back probe to %s processor may have been charged: %w", processorType, err)
+					}
+					if found {
+						slog.Info("fail-back probe was processed despite the error", "processor", processorType, "correlationId", correlationID)
+						return &PaymentProcessorResponse{Message: "payment already processed"}, processorType, nil
+					}
+				}
+				slog.Debug("fail-back probe failed", "processor", processorType, "correlationId", correlationID, "error", err)
+				continue
+			}
+		} else {
+			if !ps.isProcessorHealthy(ctx, processorType) {
+				slog.Debug("processor is not healthy, skipping", "processor", processorType, "correlationId", correlationID)
+				continue
+			}
+			resp, err = ps.processPaymentWithRetry(ctx, req, processorType)
+		}
 		if err != nil {
-			log.Printf("Failed to process payment with %s processor: %v", processorType, err)
+			slog.Warn("failed to process payment", "processor", processorType, "correlationId", correlationID, "error", err)
+			if ClassifyError(err) == ErrorClassRejected {
+				// The processor refused the payment itself; the other one won't
+				// accept it either and this one isn't unhealthy.
+				return nil, processorType, err
+			}
+			if errors.Is(err, ErrRetryDeadline) {
+				return nil, processorType, err
+			}
 			ps.markProcessorUnhealthy(processorType)
+			lastErr = err
 			continue
 		}
 
+		ps.observeLatency(processorType, time.Since(start))
 		return resp, processorType, nil
 	}
 
 	return nil, "", fmt.Errorf("all payment processors failed")
 }
 
+// States returns the cached view of every processor that routing decisions
+// are based on.
+func (ps *ProcessorService) States() []ProcessorState {
+	return ps.states()
+}
+
+// states snapshots the cached health and recent latency of every processor
+// without triggering health checks.
+func (ps *ProcessorService) states() []ProcessorState {
+	states := make([]ProcessorState, len(ps.processors))
+
+	ps.healthCacheMutex.RLock()
+	for i, processorType := range ps.processors {
+		healthy, checked := ps.healthCache[processorType]
+		minResponseTime := ps.minResponseTime[processorType]
+		states[i] = ProcessorState{
+			Type:              processorType,
+			Healthy:           healthy || !checked,
+			Slow:              ps.slowThreshold > 0 && time.Duration(minResponseTime)*time.Millisecond > ps.slowThreshold,
+			MinResponseTimeMs: minResponseTime,
+			FeeRate:           ps.FeeRate(processorType),
+		}
+	}
+	ps.healthCacheMutex.RUnlock()
+
+	ps.latencyMutex.Lock()
+	for i := range states {
+		states[i].LatencyMs = ps.latencyMs[states[i].Type]
+	}
+	ps.latencyMutex.Unlock()
+
+	for i := range states {
+		if limiter, ok := ps.limiters[states[i].Type]; ok {
+			states[i].InFlight, states[i].MaxInFlight = limiter.usage()
+		}
+	}
+
+	return states
+}
+
+func (ps *ProcessorService) observeLatency(processorType ProcessorType, d time.Duration) {
+	if tracker, ok := ps.callLatency[processorType]; ok {
+		tracker.Observe(d)
+	}
+
+	sample := float64(d) / float64(time.Millisecond)
+
+	ps.latencyMutex.Lock()
+	if current, ok := ps.latencyMs[processorType]; ok {
+		sample = current + latencySmoothing*(sample-current)
+	}
+	ps.latencyMs[processorType] = sample
+	ps.latencyMutex.Unlock()
+}
+
+// WarmUp primes the HTTP connections to every processor and seeds the health
+// cache, so the first payments don't have to wait on a health check.
+func (ps *ProcessorService) WarmUp(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, processorType := range ps.processors {
+		wg.Add(1)
+		go func(processorType ProcessorType) {
+			defer wg.Done()
+			ps.checkAndCacheHealth(ctx, processorType)
+		}(processorType)
+	}
+	wg.Wait()
+}
+
+// VerifyPayment asks the processor whether it has a record of the payment.
+// It never submits anything, so it is safe to call while reconciling.
+func (ps *ProcessorService) VerifyPayment(ctx context.Context, correlationID uuid.UUID, processorType ProcessorType) (bool, error) {
+	_, err := ps.client.GetPayment(ctx, correlationID, processorType)
+	if errors.Is(err, ErrPaymentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (ps *ProcessorService) processPaymentWithRetry(ctx context.Context, req PaymentProcessorRequest, processorType ProcessorType) (*PaymentProcessorResponse, error) {
-	maxRetries := 3
-	baseDelay := 100 * time.Millisecond
+	policy := ps.RetryPolicy()
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	var err error
+	// uncertain is set once an attempt may have reached the processor
+	// without us seeing its answer
+	uncertain := false
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
 		if attempt > 0 {
-			delay := time.Duration(attempt) * baseDelay
+			delay := policy.Delay(attempt)
+			if !retryAllowed(ctx, delay) {
+				return nil, fmt.Errorf("%w: %w", ErrRetryDeadline, err)
+			}
 			select {
 			case <-time.After(delay):
 			case <-ctx.Done():
@@ -69,56 +335,153 @@ func (ps *ProcessorService) processPaymentWithRetry(ctx context.Context, req Pay
 			}
 		}
 
-		resp, err := ps.client.ProcessPayment(ctx, req, processorType)
-		if err != nil {
-			log.Printf("Payment attempt %d failed for %s processor: %v", attempt+1, processorType, err)
-			continue
+		var resp *PaymentProcessorResponse
+		resp, err = ps.sendPayment(ctx, req, processorType)
+		if err == nil {
+			return resp, nil
 		}
 
-		return resp, nil
+		class := ClassifyError(err)
+		slog.Warn("payment attempt failed", "attempt", attempt+1, "processor", processorType, "correlationId", req.CorrelationID, "errorClass", class, "error", err)
+		if class == ErrorClassRejected && uncertain {
+			// The rejection may be for a correlationId an earlier attempt
+			// already charged
+			found, verifyErr := ps.VerifyPayment(ctx, req.CorrelationID, processorType)
+			if verifyErr != nil {
+				slog.Warn("failed to verify rejected retry", "processor", processorType, "correlationId", req.CorrelationID, "error", verifyErr)
+			} else if found {
+				slog.Info("rejected retry was already processed", "processor", processorType, "correlationId", req.CorrelationID)
+				return &PaymentProcessorResponse{Message: "payment already processed"}, nil
+			}
+		}
+		if !policy.Retryable(class) {
+			return nil, err
+		}
+		uncertain = true
+	}
+
+	return nil, fmt.Errorf("payment failed after %d attempts with %s processor: %w", policy.MaxAttempts, processorType, err)
+}
+
+// sendPayment makes one payment call once the processor is under its
+// in-flight limit, waiting for a slot until ctx is done.
+func (ps *ProcessorService) sendPayment(ctx context.Context, req PaymentProcessorRequest, processorType ProcessorType) (*PaymentProcessorResponse, error) {
+	limiter, ok := ps.limiters[processorType]
+	if !ok {
+		return ps.client.ProcessPayment(ctx, req, processorType)
+	}
+	if err := limiter.acquire(ctx); err != nil {
+		return nil, fmt.Errorf("%w: waiting for a %s processor slot: %w", errNotSent, processorType, err)
 	}
+	defer limiter.release()
 
-	return nil, fmt.Errorf("payment failed after %d attempts with %s processor", maxRetries, processorType)
+	start := time.Now()
+	resp, err := ps.client.ProcessPayment(ctx, req, processorType)
+	if controller, ok := ps.adaptive[processorType]; ok {
+		if limit, changed := controller.observe(time.Since(start), err); changed {
+			limiter.setLimit(limit)
+			slog.Debug("adjusted processor concurrency", "processor", processorType, "limit", limit)
+		}
+	}
+	return resp, err
 }
 
+// isProcessorHealthy returns the cached health, refreshing it once the
+// cooldown has passed. Only one caller per processor runs the check; the
+// others keep reading the cached value meanwhile, since the processors' health
+// endpoint is rate limited.
 func (ps *ProcessorService) isProcessorHealthy(ctx context.Context, processorType ProcessorType) bool {
-	ps.healthCacheMutex.RLock()
+	ps.healthCacheMutex.Lock()
 	
-	lastCheck, exists := ps.lastHealthCheck[processorType]
-	if exists && time.Since(lastCheck) < ps.healthCheckCooldown {
-		healthy := ps.healthCache[processorType]
-		ps.healthCacheMutex.RUnlock()
-		return healthy
+	healthy, checked := ps.healthCache[processorType]
+	if time.Now().Before(ps.nextHealthCheck[processorType]) || ps.healthChecking[processorType] {
+		ps.healthCacheMutex.Unlock()
+		return healthy || !checked
 	}
+	ps.healthChecking[processorType] = true
 	
-	ps.healthCacheMutex.RUnlock()
+	ps.healthCacheMutex.Unlock()
 
-	healthy := ps.checkAndCacheHealth(ctx, processorType)
-	return healthy
+	return ps.checkAndCacheHealth(ctx, processorType)
 }
 
 func (ps *ProcessorService) checkAndCacheHealth(ctx context.Context, processorType ProcessorType) bool {
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
-
-	_, err := ps.client.CheckHealth(ctxWithTimeout, processorType)
-	healthy := err == nil
+	start := time.Now()
+	resp, err := ps.client.CheckHealth(ctx, processorType)
+	healthy := err == nil && !resp.Failing
+	ps.recordHealthCheck(processorType, start, healthy, resp, err)
 
 	ps.healthCacheMutex.Lock()
 	ps.healthCache[processorType] = healthy
-	ps.lastHealthCheck[processorType] = time.Now()
+	if resp != nil {
+		ps.minResponseTime[processorType] = resp.MinResponseTime
+	}
+	ps.nextHealthCheck[processorType] = ps.nextCheckTime()
+	ps.healthChecking[processorType] = false
 	ps.healthCacheMutex.Unlock()
 
-	if !healthy {
-		log.Printf("Health check failed for %s processor: %v", processorType, err)
+	if err != nil {
+		slog.Warn("health check failed", "processor", processorType, "error", err)
+	} else if resp.Failing {
+		slog.Warn("processor reports failing", "processor", processorType, "minResponseTime", resp.MinResponseTime)
 	}
 
 	return healthy
 }
 
+func (ps *ProcessorService) recordHealthCheck(processorType ProcessorType, start time.Time, healthy bool, resp *HealthResponse, err error) {
+	history, ok := ps.healthHistory[processorType]
+	if !ok {
+		return
+	}
+
+	check := HealthCheck{
+		At:        start,
+		Healthy:   healthy,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if resp != nil {
+		check.MinResponseTimeMs = resp.MinResponseTime
+	}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	history.add(check)
+}
+
+// failbackProbe reports whether this payment should probe the cheapest
+// processor, which is the case when it is cached as unhealthy and no other
+// probe went out within the fail-back interval.
+func (ps *ProcessorService) failbackProbe(states []ProcessorState) (ProcessorType, bool) {
+	if ps.failback == nil {
+		return "", false
+	}
+	cheapest := ps.cheapestProcessor()
+	for _, state := range states {
+		if state.Type == cheapest && state.Healthy {
+			return "", false
+		}
+	}
+	return cheapest, ps.failback.due()
+}
+
+func (ps *ProcessorService) recordFailbackProbe(processorType ProcessorType, ok bool) {
+	if !ps.failback.record(ok) {
+		return
+	}
+	ps.healthCacheMutex.Lock()
+	ps.healthCache[processorType] = true
+	ps.healthCacheMutex.Unlock()
+	slog.Info("failing back to processor after successful probes", "processor", processorType, "successes", ps.failback.successes)
+}
+
 func (ps *ProcessorService) markProcessorUnhealthy(processorType ProcessorType) {
 	ps.healthCacheMutex.Lock()
 	ps.healthCache[processorType] = false
-	ps.lastHealthCheck[processorType] = time.Now()
+	ps.nextHealthCheck[processorType] = ps.nextCheckTime()
 	ps.healthCacheMutex.Unlock()
-}
\ No newline at end of file
+}
+
+func (ps *ProcessorService) nextCheckTime() time.Time {
+	return time.Now().Add(ps.healthCheckCooldown + rand.N(healthCheckJitter))
+}
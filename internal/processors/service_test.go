@@ -0,0 +1,98 @@
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newMockService(t *testing.T) (*ProcessorService, *MockProcessor) {
+	t.Setenv("PROCESSOR_RETRY_MAX_ATTEMPTS", "1")
+	t.Setenv("PROCESSOR_FAILBACK_INTERVAL", "0")
+	mock := NewMockProcessor()
+	return NewProcessorServiceWith(DefaultConfigs("", ""), mock), mock
+}
+
+func TestServiceFailsOverToFallback(t *testing.T) {
+	ps, mock := newMockService(t)
+	mock.Script(ProcessorTypeDefault, MockUnavailable)
+
+	correlationID := uuid.New()
+	_, processorType, err := ps.ProcessPaymentWithFallback(context.Background(), correlationID, 1990, time.Now())
+	if err != nil || processorType != ProcessorTypeFallback {
+		t.Fatalf("expected the fallback to take the payment, got %s, %v", processorType, err)
+	}
+	if found, _ := ps.VerifyPayment(context.Background(), correlationID, ProcessorTypeFallback); !found {
+		t.Error("expected the payment to be recorded on the fallback")
+	}
+
+	// The failure marked the default unhealthy until its next health check
+	if _, processorType, _ := ps.ProcessPaymentWithFallback(context.Background(), uuid.New(), 1990, time.Now()); processorType != ProcessorTypeFallback {
+		t.Errorf("expected the next payment to skip the default, got %s", processorType)
+	}
+	if calls := mock.Calls(ProcessorTypeDefault); calls != 1 {
+		t.Errorf("expected a single call to the default, got %d", calls)
+	}
+}
+
+func TestServiceStopsOnRejection(t *testing.T) {
+	ps, mock := newMockService(t)
+	mock.Script(ProcessorTypeDefault, MockRejected)
+
+	if _, _, err := ps.ProcessPaymentWithFallback(context.Background(), uuid.New(), 1990, time.Now()); err == nil {
+		t.Fatal("expected the rejection to fail the payment")
+	}
+	if calls := mock.Calls(ProcessorTypeFallback); calls != 0 {
+		t.Errorf("expected the fallback not to be tried after a rejection, got %d calls", calls)
+	}
+}
+
+func TestServiceCompletesRejectedRetryOfTimedOutPayment(t *testing.T) {
+	ps, mock := newMockService(t)
+	t.Setenv("PROCESSOR_RETRY_MAX_ATTEMPTS", "2")
+	t.Setenv("PROCESSOR_RETRY_BASE_DELAY", "1ms")
+	ps.Reload(ps.Strategy(), RetryPolicyFromEnv())
+	// The first attempt reaches the processor but its answer is lost, so
+	// the retry is refused as a duplicate
+	mock.Script(ProcessorTypeDefault, MockTimedOut, MockRejected)
+
+	_, processorType, err := ps.ProcessPaymentWithFallback(context.Background(), uuid.New(), 1990, time.Now())
+	if err != nil || processorType != ProcessorTypeDefault {
+		t.Fatalf("expected the payment completed on the default, got %s, %v", processorType, err)
+	}
+	if calls := mock.Calls(ProcessorTypeFallback); calls != 0 {
+		t.Errorf("expected the fallback not to be tried, got %d calls", calls)
+	}
+}
+
+func TestServiceFailbackProbeVerifiesUncertainFailure(t *testing.T) {
+	ps, mock := newMockService(t)
+	ps.failback = &failback{interval: time.Nanosecond, successes: 3}
+	ps.markProcessorUnhealthy(ProcessorTypeDefault)
+	// The probe reaches the default but its answer is lost
+	mock.Script(ProcessorTypeDefault, MockTimedOut)
+
+	_, processorType, err := ps.ProcessPaymentWithFallback(context.Background(), uuid.New(), 1990, time.Now())
+	if err != nil || processorType != ProcessorTypeDefault {
+		t.Fatalf("expected the probe found on the default, got %s, %v", processorType, err)
+	}
+	if calls := mock.Calls(ProcessorTypeFallback); calls != 0 {
+		t.Errorf("expected the fallback not to be charged too, got %d calls", calls)
+	}
+}
+
+func TestServiceSkipsProcessorReportedFailing(t *testing.T) {
+	ps, mock := newMockService(t)
+	mock.SetFailing(ProcessorTypeDefault, true)
+	mock.SetLatency(ProcessorTypeFallback, 5*time.Millisecond)
+
+	_, processorType, err := ps.ProcessPaymentWithFallback(context.Background(), uuid.New(), 1990, time.Now())
+	if err != nil || processorType != ProcessorTypeFallback {
+		t.Fatalf("expected the fallback to take the payment, got %s, %v", processorType, err)
+	}
+	if calls := mock.Calls(ProcessorTypeDefault); calls != 0 {
+		t.Errorf("expected no payment sent to a processor reporting failing, got %d", calls)
+	}
+}
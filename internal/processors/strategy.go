@@ -0,0 +1,180 @@
+package processors
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcessorState is what a Strategy knows about a processor when routing a
+// payment. Healthy reflects the cached health and is true when no check has
+// run yet. MinResponseTimeMs is what the processor's health endpoint last
+// reported, and Slow is set when it exceeds the configured threshold.
+// LatencyMs is zero until a payment has succeeded on it. InFlight counts the
+// payments being sent to it, bounded by MaxInFlight unless that is zero.
+type ProcessorState struct {
+	Type              ProcessorType `json:"type"`
+	Healthy           bool          `json:"healthy"`
+	Slow              bool          `json:"slow"`
+	MinResponseTimeMs int           `json:"minResponseTimeMs"`
+	LatencyMs         float64       `json:"latencyMs"`
+	FeeRate           float64       `json:"feeRate"`
+	InFlight          int           `json:"inFlight"`
+	MaxInFlight       int           `json:"maxInFlight"`
+}
+
+// Strategy decides the order in which processors are tried for a payment.
+// Processors missing from the result are not tried at all.
+type Strategy interface {
+	Name() string
+	Order(states []ProcessorState) []ProcessorType
+}
+
+// NewStrategy returns the strategy for name: "failover" (the default),
+// "fee", "latency" or "weighted", which takes its weights from
+// PROCESSOR_WEIGHTS.
+func NewStrategy(name string) (Strategy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "failover":
+		return FailoverOnly{}, nil
+	case "fee":
+		return FeeOptimized{}, nil
+	case "latency":
+		return LatencyOptimized{}, nil
+	case "weighted":
+		return NewWeighted(os.Getenv("PROCESSOR_WEIGHTS"))
+	default:
+		return nil, fmt.Errorf("unknown processor strategy %q", name)
+	}
+}
+
+// FailoverOnly tries processors in their configured order, default first.
+type FailoverOnly struct{}
+
+func (FailoverOnly) Name() string { return "failover" }
+
+func (FailoverOnly) Order(states []ProcessorState) []ProcessorType {
+	return orderBy(states, func(a, b ProcessorState) bool { return false })
+}
+
+// FeeOptimized tries the cheapest healthy processor first.
+type FeeOptimized struct{}
+
+func (FeeOptimized) Name() string { return "fee" }
+
+func (FeeOptimized) Order(states []ProcessorState) []ProcessorType {
+	return orderBy(states, func(a, b ProcessorState) bool { return a.FeeRate < b.FeeRate })
+}
+
+// LatencyOptimized tries the fastest healthy processor first, breaking ties on
+// fee. A processor without latency samples sorts first so it gets measured.
+type LatencyOptimized struct{}
+
+func (LatencyOptimized) Name() string { return "latency" }
+
+func (LatencyOptimized) Order(states []ProcessorState) []ProcessorType {
+	return orderBy(states, func(a, b ProcessorState) bool {
+		if a.LatencyMs != b.LatencyMs {
+			return a.LatencyMs < b.LatencyMs
+		}
+		return a.FeeRate < b.FeeRate
+	})
+}
+
+// Weighted sends each payment first to one of the healthy, not slow
+// processors, picked at random in proportion to its weight, so a 90/10 split
+// canaries the second processor with a tenth of the traffic. The others
+// follow in failover order in case the pick fails. Processors without a
+// weight only get payments as a fallback.
+type Weighted struct {
+	weights map[ProcessorType]int
+	// random returns a number in [0, n); rand.IntN when nil
+	random func(n int) int
+}
+
+// NewWeighted parses weights such as "default=90,fallback=10". Weights are
+// relative, they don't need to add up to 100.
+func NewWeighted(raw string) (Weighted, error) {
+	weights := make(map[ProcessorType]int)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || weight < 0 {
+			return Weighted{}, fmt.Errorf("invalid processor weight %q", part)
+		}
+		weights[ProcessorType(strings.TrimSpace(name))] = weight
+	}
+	if len(weights) == 0 {
+		return Weighted{}, fmt.Errorf("weighted strategy needs PROCESSOR_WEIGHTS")
+	}
+	return Weighted{weights: weights}, nil
+}
+
+func (Weighted) Name() string { return "weighted" }
+
+func (w Weighted) Order(states []ProcessorState) []ProcessorType {
+	order := FailoverOnly{}.Order(states)
+
+	total := 0
+	for _, s := range states {
+		if rank(s) == 0 {
+			total += w.weights[s.Type]
+		}
+	}
+	if total == 0 {
+		return order
+	}
+
+	random := w.random
+	if random == nil {
+		random = rand.IntN
+	}
+	n := random(total)
+	for _, s := range states {
+		if rank(s) != 0 {
+			continue
+		}
+		if n -= w.weights[s.Type]; n < 0 {
+			return moveToFront(order, s.Type)
+		}
+	}
+	return order
+}
+
+// orderBy stable-sorts processors into healthy, healthy but slow, and
+// unhealthy, then by less within each group. Unhealthy processors are kept at
+// the end because the cached health can be stale; the service re-checks
+// before trying them.
+func orderBy(states []ProcessorState, less func(a, b ProcessorState) bool) []ProcessorType {
+	sorted := append([]ProcessorState(nil), states...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ri, rj := rank(sorted[i]), rank(sorted[j]); ri != rj {
+			return ri < rj
+		}
+		return less(sorted[i], sorted[j])
+	})
+
+	order := make([]ProcessorType, len(sorted))
+	for i, s := range sorted {
+		order[i] = s.Type
+	}
+	return order
+}
+
+func rank(s ProcessorState) int {
+	switch {
+	case !s.Healthy:
+		return 2
+	case s.Slow:
+		return 1
+	default:
+		return 0
+	}
+}
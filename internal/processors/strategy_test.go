@@ -0,0 +1,86 @@
+package processors
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrategyOrder(t *testing.T) {
+	states := []ProcessorState{
+		{Type: ProcessorTypeDefault, Healthy: true, LatencyMs: 120, FeeRate: 0.03},
+		{Type: ProcessorTypeFallback, Healthy: true, LatencyMs: 15, FeeRate: 0.05},
+	}
+	unhealthyDefault := []ProcessorState{
+		{Type: ProcessorTypeDefault, Healthy: false, LatencyMs: 10, FeeRate: 0.03},
+		{Type: ProcessorTypeFallback, Healthy: true, LatencyMs: 15, FeeRate: 0.05},
+	}
+
+	slowDefault := []ProcessorState{
+		{Type: ProcessorTypeDefault, Healthy: true, Slow: true, MinResponseTimeMs: 900, FeeRate: 0.03},
+		{Type: ProcessorTypeFallback, Healthy: true, FeeRate: 0.05},
+	}
+
+	tests := []struct {
+		strategy Strategy
+		states   []ProcessorState
+		want     []ProcessorType
+	}{
+		{FailoverOnly{}, states, []ProcessorType{ProcessorTypeDefault, ProcessorTypeFallback}},
+		{FeeOptimized{}, states, []ProcessorType{ProcessorTypeDefault, ProcessorTypeFallback}},
+		{LatencyOptimized{}, states, []ProcessorType{ProcessorTypeFallback, ProcessorTypeDefault}},
+		{FailoverOnly{}, unhealthyDefault, []ProcessorType{ProcessorTypeFallback, ProcessorTypeDefault}},
+		{LatencyOptimized{}, unhealthyDefault, []ProcessorType{ProcessorTypeFallback, ProcessorTypeDefault}},
+		{FeeOptimized{}, slowDefault, []ProcessorType{ProcessorTypeFallback, ProcessorTypeDefault}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.strategy.Order(tt.states); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s.Order() = %v, want %v", tt.strategy.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestWeightedSplitsHealthyTraffic(t *testing.T) {
+	w, err := NewWeighted("default=90, fallback=10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states := []ProcessorState{
+		{Type: ProcessorTypeDefault, Healthy: true},
+		{Type: ProcessorTypeFallback, Healthy: true},
+	}
+
+	counts := make(map[ProcessorType]int)
+	for i := 0; i < 100; i++ {
+		w.random = func(n int) int { return i % n }
+		counts[w.Order(states)[0]]++
+	}
+	if counts[ProcessorTypeDefault] != 90 || counts[ProcessorTypeFallback] != 10 {
+		t.Errorf("expected a 90/10 split, got %v", counts)
+	}
+
+	states[1].Healthy = false
+	w.random = func(n int) int { return n - 1 }
+	want := []ProcessorType{ProcessorTypeDefault, ProcessorTypeFallback}
+	if got := w.Order(states); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the unhealthy processor to only be a fallback, got %v", got)
+	}
+
+	for _, raw := range []string{"", "default", "default=-1", "default=abc"} {
+		if _, err := NewWeighted(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	for name, want := range map[string]string{"": "failover", "FEE": "fee", "latency": "latency"} {
+		s, err := NewStrategy(name)
+		if err != nil || s.Name() != want {
+			t.Errorf("NewStrategy(%q) = %v, %v; want %s", name, s, err, want)
+		}
+	}
+	if _, err := NewStrategy("random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
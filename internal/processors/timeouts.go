@@ -0,0 +1,69 @@
+package processors
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPaymentTimeout = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+	defaultLookupTimeout  = 5 * time.Second
+)
+
+// Timeouts bounds each kind of processor call separately, so a slow health
+// probe or lookup never eats into the payment latency budget.
+type Timeouts struct {
+	Payment map[ProcessorType]time.Duration
+	Health  time.Duration
+	Lookup  time.Duration
+}
+
+// TimeoutsFromEnv reads PAYMENT_TIMEOUT_<NAME> for each processor (e.g.
+// PAYMENT_TIMEOUT_DEFAULT), HEALTH_TIMEOUT and LOOKUP_TIMEOUT as durations
+// such as "800ms".
+func TimeoutsFromEnv(processors []ProcessorType) Timeouts {
+	payment := make(map[ProcessorType]time.Duration, len(processors))
+	for _, processorType := range processors {
+		payment[processorType] = envDuration(processorEnv("PAYMENT_TIMEOUT", processorType), defaultPaymentTimeout)
+	}
+
+	return Timeouts{
+		Payment: payment,
+		Health:  envDuration("HEALTH_TIMEOUT", defaultHealthTimeout),
+		Lookup:  envDuration("LOOKUP_TIMEOUT", defaultLookupTimeout),
+	}
+}
+
+// processorEnv returns the per-processor variable prefix_NAME, with the
+// processor name upper-cased and anything that can't appear in a variable
+// name replaced by an underscore.
+func processorEnv(prefix string, processorType ProcessorType) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, string(processorType))
+	return prefix + "_" + name
+}
+
+func (t Timeouts) payment(processorType ProcessorType) time.Duration {
+	if d, ok := t.Payment[processorType]; ok && d > 0 {
+		return d
+	}
+	return defaultPaymentTimeout
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
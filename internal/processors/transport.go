@@ -0,0 +1,56 @@
+package processors
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newTransport builds the HTTP transport for hosts processors.
+// http.DefaultTransport keeps only 2 idle connections per host, which at
+// load-test rates means constantly dialing new ones, so the pool sizes are
+// raised and env-tunable:
+//
+//   - PROCESSOR_MAX_IDLE_CONNS_PER_HOST (default 100)
+//   - PROCESSOR_MAX_CONNS_PER_HOST (default 0, unlimited)
+//   - PROCESSOR_IDLE_CONN_TIMEOUT (default 90s)
+//   - PROCESSOR_HTTP2 (default false; only applies to https processor URLs)
+func newTransport(hosts int) *http.Transport {
+	maxIdlePerHost := envInt("PROCESSOR_MAX_IDLE_CONNS_PER_HOST", defaultMaxIdleConnsPerHost)
+	forceHTTP2, _ := strconv.ParseBool(os.Getenv("PROCESSOR_HTTP2"))
+
+	idleTimeout := defaultIdleConnTimeout
+	if v, err := time.ParseDuration(os.Getenv("PROCESSOR_IDLE_CONN_TIMEOUT")); err == nil && v > 0 {
+		idleTimeout = v
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        maxIdlePerHost * max(hosts, 1),
+		MaxIdleConnsPerHost: maxIdlePerHost,
+		MaxConnsPerHost:     envInt("PROCESSOR_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:     idleTimeout,
+		// Payloads are tiny JSON documents; gzip only adds CPU.
+		DisableCompression: true,
+		ForceAttemptHTTP2:  forceHTTP2,
+	}
+}
+
+func envInt(name string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
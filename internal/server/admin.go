@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/logging"
+	"rinha-backend-2025/internal/models"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// adminAuthMiddleware guards the /admin group with the ADMIN_TOKEN shared
+// secret. Without a configured token the admin API is disabled.
+func (s *Server) adminAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.adminToken == "" {
+			return apiError(http.StatusForbidden, models.ErrorCodeForbidden, "Admin API is disabled")
+		}
+
+		if !s.validAdminToken(c.Request().Header.Get(adminTokenHeader)) {
+			return apiError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Invalid admin token")
+		}
+
+		return next(c)
+	}
+}
+
+// validAdminToken reports whether token is the configured ADMIN_TOKEN.
+func (s *Server) validAdminToken(token string) bool {
+	return s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+type logSettings struct {
+	Level   string `json:"level"`
+	HotPath bool   `json:"hotPath"`
+}
+
+type logSettingsUpdate struct {
+	Level   *string `json:"level"`
+	HotPath *bool   `json:"hotPath"`
+}
+
+func currentLogSettings() logSettings {
+	return logSettings{
+		Level:   logging.LevelName(),
+		HotPath: logging.HotPathEnabled(),
+	}
+}
+
+func (s *Server) getLogSettingsHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, currentLogSettings())
+}
+
+func (s *Server) updateLogSettingsHandler(c echo.Context) error {
+	var req logSettingsUpdate
+	if err := c.Bind(&req); err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid request format")
+	}
+
+	if req.Level != nil {
+		level, err := logging.ParseLevel(*req.Level)
+		if err != nil {
+			return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, err.Error())
+		}
+		logging.SetLevel(level)
+	}
+
+	if req.HotPath != nil {
+		logging.SetHotPath(*req.HotPath)
+	}
+
+	return c.JSON(http.StatusOK, currentLogSettings())
+}
+
+type dlqRequeueRequest struct {
+	PaymentID *uuid.UUID `json:"paymentId"`
+	Limit     int        `json:"limit"`
+}
+
+// dlqRequeueHandler moves failed payments back to the queue. Without a body it
+// requeues as many retryable failures as the queue has room for; a paymentId
+// is requeued whatever its failure reason.
+func (s *Server) dlqRequeueHandler(c echo.Context) error {
+	var req dlqRequeueRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid request format")
+	}
+
+	requeued, err := s.workerPool.RequeueFailed(c.Request().Context(), s.registry.ID(), req.PaymentID, req.Limit)
+	if err != nil {
+		slog.Error("failed to requeue failed payments", "requeued", requeued, "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to requeue payments")
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"requeued": requeued})
+}
+
+type workersStateResponse struct {
+	Paused      bool `json:"paused"`
+	BusyWorkers int  `json:"busyWorkers"`
+	QueueLength int  `json:"queueLength"`
+}
+
+// pauseWorkersHandler stops workers from taking new jobs. In-flight jobs
+// finish; poll GET /admin/queues until no worker is busy to know the pipeline
+// is flushed.
+func (s *Server) pauseWorkersHandler(c echo.Context) error {
+	s.workerPool.Pause()
+	return c.JSON(http.StatusOK, s.workersState())
+}
+
+func (s *Server) resumeWorkersHandler(c echo.Context) error {
+	s.workerPool.Resume()
+	return c.JSON(http.StatusOK, s.workersState())
+}
+
+func (s *Server) workersState() workersStateResponse {
+	stats := s.workerPool.QueueStats()
+	state := workersStateResponse{Paused: stats.Paused, QueueLength: stats.QueueLength}
+	for _, worker := range stats.Workers {
+		if worker.Busy {
+			state.BusyWorkers++
+		}
+	}
+	return state
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/processors"
+)
+
+const defaultWorkerCount = 5
+
+// reloadableSettings are the environment variables POST /admin/config may
+// change, each with the check its value must pass. Anything else needs a
+// restart. An empty value restores the default.
+var reloadableSettings = map[string]func(string) error{
+	"WORKER_COUNT":                 positiveInt,
+	"PROCESSOR_STRATEGY":           validStrategy,
+	"PROCESSOR_RETRY_MAX_ATTEMPTS": positiveInt,
+	"PROCESSOR_RETRY_BASE_DELAY":   positiveDuration,
+	"PROCESSOR_RETRY_MAX_DELAY":    positiveDuration,
+	"PROCESSOR_RETRY_BACKOFF":      floatAtLeast(1),
+	"PROCESSOR_RETRY_JITTER":       fraction,
+	"PROCESSOR_RETRY_ON_TIMEOUT":   validBool,
+}
+
+func positiveInt(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+		return errors.New("must be a positive integer")
+	}
+	return nil
+}
+
+func positiveDuration(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+		return errors.New("must be a positive duration such as 100ms")
+	}
+	return nil
+}
+
+func floatAtLeast(min float64) func(string) error {
+	return func(v string) error {
+		if f, err := strconv.ParseFloat(v, 64); err != nil || f < min {
+			return fmt.Errorf("must be a number of at least %g", min)
+		}
+		return nil
+	}
+}
+
+func fraction(v string) error {
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 || f > 1 {
+		return errors.New("must be a number between 0 and 1")
+	}
+	return nil
+}
+
+func validBool(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func validStrategy(v string) error {
+	_, err := processors.NewStrategy(v)
+	return err
+}
+
+// loadWorkerCount parses WORKER_COUNT.
+func loadWorkerCount() int {
+	return parseWorkerCount(os.Getenv("WORKER_COUNT"))
+}
+
+func parseWorkerCount(v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return defaultWorkerCount
+	}
+	return n
+}
+
+// runtimeSettings are the parsed values of reloadableSettings.
+type runtimeSettings struct {
+	workers  int
+	strategy processors.Strategy
+	retry    processors.RetryPolicy
+}
+
+// parseRuntimeSettings reads the reloadable settings through getenv. The
+// weighted strategy can be kept but not switched to, since PROCESSOR_WEIGHTS
+// is only read at startup.
+func (s *Server) parseRuntimeSettings(getenv func(string) string) (runtimeSettings, error) {
+	name := getenv("PROCESSOR_STRATEGY")
+	strategy := s.processors.Strategy()
+	if !strings.EqualFold(strings.TrimSpace(name), "weighted") {
+		var err error
+		if strategy, err = processors.NewStrategy(name); err != nil {
+			return runtimeSettings{}, err
+		}
+	} else if strategy.Name() != "weighted" {
+		return runtimeSettings{}, errors.New("PROCESSOR_STRATEGY: weighted can only be set at startup, PROCESSOR_WEIGHTS is not reloadable")
+	}
+
+	return runtimeSettings{
+		workers:  parseWorkerCount(getenv("WORKER_COUNT")),
+		strategy: strategy,
+		retry:    processors.RetryPolicyFrom(getenv),
+	}, nil
+}
+
+// applyRuntimeSettings parses the settings read through getenv and applies
+// them, or changes nothing if they are invalid. The caller holds
+// reloadMutex.
+func (s *Server) applyRuntimeSettings(getenv func(string) string) error {
+	settings, err := s.parseRuntimeSettings(getenv)
+	if err != nil {
+		return err
+	}
+	s.processors.Reload(settings.strategy, settings.retry)
+	s.workerPool.SetWorkers(settings.workers)
+	return nil
+}
+
+// Reload re-reads .env and re-applies the runtime tunables from the
+// environment. Queued payments and open connections are kept.
+func (s *Server) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	if err := godotenv.Overload(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read .env: %w", err)
+	}
+	return s.applyRuntimeSettings(os.Getenv)
+}
+
+type runtimeConfig struct {
+	Workers          int    `json:"workers"`
+	Strategy         string `json:"strategy"`
+	RetryMaxAttempts int    `json:"retryMaxAttempts"`
+}
+
+func (s *Server) currentConfig() runtimeConfig {
+	return runtimeConfig{
+		Workers:          s.workerPool.Workers(),
+		Strategy:         s.processors.Strategy().Name(),
+		RetryMaxAttempts: s.processors.RetryPolicy().MaxAttempts,
+	}
+}
+
+// reloadConfigHandler applies the given settings on top of the environment
+// and records them there, so later reloads keep them. An invalid value is
+// reported with its key and nothing is changed.
+func (s *Server) reloadConfigHandler(c echo.Context) error {
+	updates := map[string]string{}
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&updates); err != nil {
+			return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid request format")
+		}
+	}
+
+	for key, value := range updates {
+		validate, ok := reloadableSettings[key]
+		if !ok {
+			return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, key+" cannot be changed at runtime")
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if err := validate(value); err != nil {
+			return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, key+": "+err.Error())
+		}
+	}
+
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	getenv := func(key string) string {
+		if value, ok := updates[key]; ok {
+			return strings.TrimSpace(value)
+		}
+		return os.Getenv(key)
+	}
+	if err := s.applyRuntimeSettings(getenv); err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, err.Error())
+	}
+	for key, value := range updates {
+		os.Setenv(key, strings.TrimSpace(value))
+	}
+
+	return c.JSON(http.StatusOK, s.currentConfig())
+}
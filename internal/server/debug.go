@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+)
+
+// gcPausesReported is how many of the most recent GC pauses /debug/runtime
+// lists.
+const gcPausesReported = 16
+
+// runtimeStats is the body of /debug/runtime.
+type runtimeStats struct {
+	Goroutines     int       `json:"goroutines"`
+	HeapAllocBytes uint64    `json:"heapAllocBytes"`
+	HeapInuseBytes uint64    `json:"heapInuseBytes"`
+	HeapObjects    uint64    `json:"heapObjects"`
+	SysBytes       uint64    `json:"sysBytes"`
+	TotalAllocs    uint64    `json:"totalAllocs"`
+	NumGC          uint32    `json:"numGC"`
+	GCPauseTotalMs float64   `json:"gcPauseTotalMs"`
+	RecentPausesMs []float64 `json:"recentGcPausesMs"`
+	LastGC         time.Time `json:"lastGc"`
+}
+
+// startDebugServer serves net/http/pprof and /debug/runtime on DEBUG_ADDR
+// (e.g. "127.0.0.1:6060"), apart from the API port so profiles can be taken
+// during a load run. It returns nil when DEBUG_ADDR is unset.
+func startDebugServer() *http.Server {
+	addr := os.Getenv("DEBUG_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/runtime", runtimeHandler)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("debug server failed", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("serving pprof and runtime stats", "addr", addr)
+	return srv
+}
+
+func runtimeHandler(w http.ResponseWriter, _ *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := runtimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: m.HeapAlloc,
+		HeapInuseBytes: m.HeapInuse,
+		HeapObjects:    m.HeapObjects,
+		SysBytes:       m.Sys,
+		TotalAllocs:    m.Mallocs,
+		NumGC:          m.NumGC,
+		GCPauseTotalMs: float64(m.PauseTotalNs) / float64(time.Millisecond),
+		RecentPausesMs: []float64{},
+	}
+	if m.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(m.LastGC)).UTC()
+	}
+	// PauseNs is a circular buffer whose latest entry is at (NumGC+255)%256
+	for i := uint32(0); i < gcPausesReported && i < m.NumGC; i++ {
+		pause := m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))]
+		stats.RecentPausesMs = append(stats.RecentPausesMs, float64(pause)/float64(time.Millisecond))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+func stopDebugServer(srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("failed to stop debug server", "error", err)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/workers"
+)
+
+const (
+	defaultDeferredPayments = 10000
+	deferredFlushInterval   = time.Second
+)
+
+// deferredPayments holds payments accepted while the database was unreachable
+// and writes them once it is back, so a short outage degrades to delayed
+// processing instead of rejected requests. The buffer only lives in memory:
+// payments still in it when the instance dies are lost.
+type deferredPayments struct {
+	db         database.Service
+	workerPool *workers.PaymentWorkerPool
+	max        int
+	// summaryCache is invalidated for each payment written; may be nil
+	summaryCache *summaryCache
+
+	mu       sync.Mutex
+	payments []*models.Payment
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// newDeferredPayments reads DEGRADED_BUFFER_SIZE; zero disables degraded mode.
+func newDeferredPayments(db database.Service, workerPool *workers.PaymentWorkerPool, summaryCache *summaryCache) *deferredPayments {
+	max := defaultDeferredPayments
+	if v, err := strconv.Atoi(os.Getenv("DEGRADED_BUFFER_SIZE")); err == nil && v >= 0 {
+		max = v
+	}
+	if max == 0 {
+		return nil
+	}
+	return &deferredPayments{db: db, workerPool: workerPool, max: max, summaryCache: summaryCache}
+}
+
+// add buffers payment and reports whether there was room for it.
+func (d *deferredPayments) add(payment *models.Payment) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.payments) >= d.max {
+		return false
+	}
+	d.payments = append(d.payments, payment)
+	if len(d.payments) == 1 {
+		slog.Warn("database unavailable, buffering accepted payments", "max", d.max)
+	}
+	return true
+}
+
+func (d *deferredPayments) size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.payments)
+}
+
+func (d *deferredPayments) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(deferredFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.flush(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop makes a last attempt to write the buffer before giving up on it.
+func (d *deferredPayments) stop() {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d.flush(ctx)
+
+	// Payments already written stay pending and are reclaimed with the rest
+	// of this instance's
+	d.mu.Lock()
+	unwritten := 0
+	for _, payment := range d.payments {
+		if payment.ID == uuid.Nil {
+			unwritten++
+		}
+	}
+	d.mu.Unlock()
+	if unwritten > 0 {
+		slog.Error("discarding buffered payments, database still unavailable", "payments", unwritten)
+	}
+}
+
+// flush writes buffered payments in order and queues them, stopping at the
+// first one the database can't take yet or the queue has no room for. A
+// payment already written keeps its ID and is only queued on the next flush,
+// since its client was told it was accepted.
+func (d *deferredPayments) flush(ctx context.Context) {
+	d.mu.Lock()
+	pending := d.payments
+	d.payments = nil
+	d.mu.Unlock()
+
+	requeue := func(rest []*models.Payment) {
+		d.mu.Lock()
+		d.payments = append(rest, d.payments...)
+		d.mu.Unlock()
+	}
+
+	for i, payment := range pending {
+		if payment.ID == uuid.Nil {
+			err := d.db.CreatePayment(ctx, payment)
+			if database.IsUnavailable(err) {
+				requeue(pending[i:])
+				return
+			}
+			if err != nil {
+				slog.Error("dropping buffered payment rejected by the database", "correlationId", payment.CorrelationID, "error", err)
+				continue
+			}
+			d.summaryCache.invalidate()
+		}
+
+		err := d.workerPool.SubmitPayment(*payment)
+		if errors.Is(err, workers.ErrQueueFull) {
+			requeue(pending[i:])
+			return
+		}
+		if err != nil {
+			slog.Error("failed to submit buffered payment", "paymentId", payment.ID, "correlationId", payment.CorrelationID, "error", err)
+		}
+	}
+
+	if len(pending) > 0 {
+		slog.Info("database available again, flushed buffered payments", "payments", len(pending))
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/workers"
+)
+
+type flakyDB struct {
+	stubDB
+	down    bool
+	created int
+}
+
+func (db *flakyDB) CreatePayment(_ context.Context, payment *models.Payment) error {
+	if db.down {
+		return errors.New("dial tcp: connection refused")
+	}
+	db.created++
+	payment.ID = uuid.New()
+	return nil
+}
+
+func TestDeferredPaymentsFlushWhenDatabaseReturns(t *testing.T) {
+	db := &flakyDB{down: true}
+	pool := workers.NewPaymentWorkerPool(1, 2, nil, db)
+	cache := &summaryCache{ttl: time.Minute, entries: make(map[summaryKey]cachedSummary)}
+	deferred := &deferredPayments{db: db, workerPool: pool, max: 2, summaryCache: cache}
+
+	for i := 0; i < 3; i++ {
+		added := deferred.add(&models.Payment{CorrelationID: uuid.New(), Amount: 1000})
+		if want := i < 2; added != want {
+			t.Fatalf("add() #%d = %v, want %v", i+1, added, want)
+		}
+	}
+
+	deferred.flush(context.Background())
+	if deferred.size() != 2 || db.created != 0 {
+		t.Fatalf("expected payments to stay buffered while the database is down, size = %d", deferred.size())
+	}
+
+	_, generation, _ := cache.get(summaryKey{})
+	cache.put(summaryKey{}, generation, models.PaymentSummaryResponse{})
+
+	db.down = false
+	deferred.flush(context.Background())
+	if deferred.size() != 0 || db.created != 2 {
+		t.Fatalf("expected buffer to be flushed, size = %d, created = %d", deferred.size(), db.created)
+	}
+	if n := pool.QueueLength(); n != 2 {
+		t.Errorf("expected flushed payments to be queued, queue length = %d", n)
+	}
+	if _, _, ok := cache.get(summaryKey{}); ok {
+		t.Error("expected the flushed payments to invalidate cached summaries")
+	}
+}
+
+func TestDeferredPaymentsWaitForQueueRoom(t *testing.T) {
+	db := &flakyDB{}
+	pool := workers.NewPaymentWorkerPool(1, 1, nil, db)
+	deferred := &deferredPayments{db: db, workerPool: pool, max: 2}
+	deferred.add(&models.Payment{CorrelationID: uuid.New(), Amount: 1000})
+	deferred.add(&models.Payment{CorrelationID: uuid.New(), Amount: 1000})
+
+	// The second payment is written but finds the queue full
+	deferred.flush(context.Background())
+	if deferred.size() != 1 || db.created != 2 {
+		t.Fatalf("expected the unqueued payment kept, size = %d, created = %d", deferred.size(), db.created)
+	}
+
+	// It is only queued on a later flush, never written again
+	deferred.flush(context.Background())
+	if deferred.size() != 1 || db.created != 2 {
+		t.Errorf("expected the payment to wait for room without a second insert, size = %d, created = %d", deferred.size(), db.created)
+	}
+}
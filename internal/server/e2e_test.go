@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/processors"
+	"rinha-backend-2025/internal/testing/fakeprocessor"
+	"rinha-backend-2025/internal/workers"
+)
+
+// memoryDB keeps payments in memory for tests that run the whole
+// handler→queue→worker pipeline.
+type memoryDB struct {
+	database.Service
+	mu       sync.Mutex
+	payments map[uuid.UUID]*models.Payment
+}
+
+func (db *memoryDB) CreatePayment(_ context.Context, payment *models.Payment) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, existing := range db.payments {
+		if existing.CorrelationID == payment.CorrelationID {
+			return database.ErrDuplicateCorrelationID
+		}
+	}
+	payment.ID = uuid.New()
+	stored := *payment
+	db.payments[payment.ID] = &stored
+	return nil
+}
+
+func (db *memoryDB) UpdatePaymentStatus(_ context.Context, paymentID uuid.UUID, status models.PaymentStatus) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	payment, ok := db.payments[paymentID]
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+	if payment.Status == models.PaymentStatusCompleted {
+		return database.ErrPaymentAlreadyCompleted
+	}
+	payment.Status = status
+	return nil
+}
+
+func (db *memoryDB) TransitionPaymentStatus(_ context.Context, paymentID uuid.UUID, status models.PaymentStatus, from ...models.PaymentStatus) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	payment, ok := db.payments[paymentID]
+	if !ok || !slices.Contains(from, payment.Status) {
+		return false, nil
+	}
+	payment.Status = status
+	return true, nil
+}
+
+func (db *memoryDB) FailPayment(ctx context.Context, paymentID uuid.UUID, _ models.FailureReason) error {
+	return db.UpdatePaymentStatus(ctx, paymentID, models.PaymentStatusFailed)
+}
+
+func (db *memoryDB) ExpirePayment(ctx context.Context, paymentID uuid.UUID) (bool, error) {
+	return db.TransitionPaymentStatus(ctx, paymentID, models.PaymentStatusFailed, models.PaymentStatusPending)
+}
+
+func (db *memoryDB) CompletePayment(_ context.Context, paymentID uuid.UUID, fee models.Money, processorType string, _ time.Duration) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	payment, ok := db.payments[paymentID]
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+	if payment.Status == models.PaymentStatusCompleted {
+		return database.ErrPaymentAlreadyCompleted
+	}
+	payment.Status = models.PaymentStatusCompleted
+	payment.Fee = &fee
+	payment.ProcessorType = &processorType
+	return nil
+}
+
+func (db *memoryDB) RecordPaymentEvent(context.Context, models.PaymentEvent) error {
+	return nil
+}
+
+func (db *memoryDB) GetPaymentSummary(_ context.Context, _, _ *time.Time, _ *string) (models.PaymentSummaryResponse, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	summary := make(models.PaymentSummaryResponse)
+	for _, payment := range db.payments {
+		if payment.Status != models.PaymentStatusCompleted {
+			continue
+		}
+		totals := summary[*payment.ProcessorType]
+		totals.TotalRequests++
+		totals.TotalAmount += payment.Amount
+		summary[*payment.ProcessorType] = totals
+	}
+	return summary, nil
+}
+
+func (db *memoryDB) unfinished() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := 0
+	for _, payment := range db.payments {
+		if payment.Status != models.PaymentStatusCompleted && payment.Status != models.PaymentStatusFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// newPipeline wires a server to two fake processors through the real HTTP
+// client, worker pool and handlers.
+func newPipeline(t *testing.T, defaultOpts, fallbackOpts fakeprocessor.Options) (http.Handler, *memoryDB, *fakeprocessor.Server, *fakeprocessor.Server) {
+	t.Setenv("PROCESSOR_RETRY_BASE_DELAY", "1ms")
+	t.Setenv("PROCESSOR_FAILBACK_INTERVAL", "0")
+
+	defaultProcessor := fakeprocessor.New(defaultOpts)
+	t.Cleanup(defaultProcessor.Close)
+	fallbackProcessor := fakeprocessor.New(fallbackOpts)
+	t.Cleanup(fallbackProcessor.Close)
+
+	db := &memoryDB{payments: make(map[uuid.UUID]*models.Payment)}
+	processorService := processors.NewProcessorService(processors.DefaultConfigs(defaultProcessor.URL, fallbackProcessor.URL))
+	cache := newSummaryCacheFromEnv()
+	pool := workers.NewPaymentWorkerPool(4, 100, processorService, db)
+	pool.OnPaymentWritten(cache.invalidate)
+	pool.Start()
+	t.Cleanup(pool.Stop)
+
+	s := &Server{db: db, processors: processorService, workerPool: pool, converter: newCurrencyConverter(), insertMode: loadPaymentInsertMode(), summaryCache: cache}
+	return s.RegisterRoutes(), db, defaultProcessor, fallbackProcessor
+}
+
+func postPayments(t *testing.T, handler http.Handler, n int) {
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf(`{"correlationId": %q, "amount": 19.90}`, uuid.NewString())
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d (%s)", http.StatusAccepted, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func waitProcessed(t *testing.T, db *memoryDB) {
+	deadline := time.Now().Add(5 * time.Second)
+	for db.unfinished() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d payments still unfinished", db.unfinished())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// assertSummaryMatches compares /payments-summary with what each fake
+// processor recorded.
+func assertSummaryMatches(t *testing.T, handler http.Handler, recorded map[string]*fakeprocessor.Server) {
+	req := httptest.NewRequest(http.MethodGet, "/payments-summary", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	var summary models.PaymentSummaryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("error decoding summary: %v", err)
+	}
+	for name, processor := range recorded {
+		requests, amount := processor.Summary()
+		if got := summary[name]; got.TotalRequests != requests || got.TotalAmount != amount {
+			t.Errorf("%s: summary reports %d payments totalling %s, processor recorded %d totalling %s",
+				name, got.TotalRequests, got.TotalAmount, requests, amount)
+		}
+	}
+}
+
+func TestPipelineSummaryMatchesProcessors(t *testing.T) {
+	handler, db, defaultProcessor, fallbackProcessor := newPipeline(t, fakeprocessor.Options{}, fakeprocessor.Options{})
+
+	postPayments(t, handler, 20)
+	waitProcessed(t, db)
+
+	if requests, _ := defaultProcessor.Summary(); requests != 20 {
+		t.Errorf("expected the default processor to take all 20 payments, got %d", requests)
+	}
+	assertSummaryMatches(t, handler, map[string]*fakeprocessor.Server{"default": defaultProcessor, "fallback": fallbackProcessor})
+}
+
+func TestPipelineFailsOverWhenDefaultFails(t *testing.T) {
+	handler, db, defaultProcessor, fallbackProcessor := newPipeline(t,
+		fakeprocessor.Options{FailureRate: 0.5}, fakeprocessor.Options{Latency: time.Millisecond})
+
+	postPayments(t, handler, 20)
+	waitProcessed(t, db)
+
+	defaultRequests, _ := defaultProcessor.Summary()
+	fallbackRequests, _ := fallbackProcessor.Summary()
+	if defaultRequests+fallbackRequests != 20 {
+		t.Errorf("expected all 20 payments charged once, got %d on default and %d on fallback", defaultRequests, fallbackRequests)
+	}
+	assertSummaryMatches(t, handler, map[string]*fakeprocessor.Server{"default": defaultProcessor, "fallback": fallbackProcessor})
+}
+
+func TestPipelineInsertsInWorker(t *testing.T) {
+	t.Setenv("PAYMENT_INSERT_MODE", insertInWorker)
+	handler, db, defaultProcessor, fallbackProcessor := newPipeline(t, fakeprocessor.Options{}, fakeprocessor.Options{})
+
+	postPayments(t, handler, 10)
+	// A resubmitted correlationId is accepted but only charged once
+	body := fmt.Sprintf(`{"correlationId": %q, "amount": 5.00}`, uuid.NewString())
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d (%s)", http.StatusAccepted, resp.Code, resp.Body.String())
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if requests, _ := defaultProcessor.Summary(); requests == 11 && db.unfinished() == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			requests, _ := defaultProcessor.Summary()
+			t.Fatalf("expected 11 payments charged, got %d with %d unfinished", requests, db.unfinished())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assertSummaryMatches(t, handler, map[string]*fakeprocessor.Server{"default": defaultProcessor, "fallback": fallbackProcessor})
+}
+
+func TestPipelineSummaryCacheIsInvalidatedByWrites(t *testing.T) {
+	t.Setenv("SUMMARY_CACHE_TTL", "1h")
+	handler, db, defaultProcessor, fallbackProcessor := newPipeline(t, fakeprocessor.Options{}, fakeprocessor.Options{})
+	processors := map[string]*fakeprocessor.Server{"default": defaultProcessor, "fallback": fallbackProcessor}
+
+	// Cache the empty summary, then make sure writes don't leave it stale
+	assertSummaryMatches(t, handler, processors)
+	postPayments(t, handler, 5)
+	waitProcessed(t, db)
+	assertSummaryMatches(t, handler, processors)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/models"
+)
+
+// apiError builds an error response. Echo handlers return it as their error
+// and httpErrorHandler writes it.
+func apiError(status int, code, message string) *models.APIError {
+	return models.NewAPIError(status, code, message)
+}
+
+// errorResult is apiError for the logic shared with the raw handler, which
+// returns the status and body instead of writing them.
+func errorResult(status int, code, message string) (int, any) {
+	return status, apiError(status, code, message)
+}
+
+// httpErrorHandler writes every error returned by a handler or middleware
+// as a models.APIError, including echo's own 404s and 405s.
+func (s *Server) httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var apiErr *models.APIError
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &httpErr):
+		apiErr = fromHTTPError(httpErr)
+	default:
+		slog.ErrorContext(c.Request().Context(), "unhandled request error", "method", c.Request().Method, "path", c.Path(), "error", err)
+		apiErr = apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Internal server error")
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, apiErr)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "failed to write error response", "error", err)
+	}
+}
+
+func fromHTTPError(httpErr *echo.HTTPError) *models.APIError {
+	code := models.ErrorCodeInternal
+	switch {
+	case httpErr.Code == http.StatusNotFound:
+		code = models.ErrorCodeNotFound
+	case httpErr.Code == http.StatusMethodNotAllowed:
+		code = models.ErrorCodeMethodNotAllowed
+	case httpErr.Code == http.StatusUnauthorized:
+		code = models.ErrorCodeUnauthorized
+	case httpErr.Code == http.StatusForbidden:
+		code = models.ErrorCodeForbidden
+	case httpErr.Code < http.StatusInternalServerError:
+		code = models.ErrorCodeInvalidRequest
+	}
+
+	message := http.StatusText(httpErr.Code)
+	if httpErr.Code < http.StatusInternalServerError {
+		message = fmt.Sprint(httpErr.Message)
+	}
+	return apiError(httpErr.Code, code, message)
+}
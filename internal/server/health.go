@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/metrics"
+	"rinha-backend-2025/internal/processors"
+	"rinha-backend-2025/internal/workers"
+)
+
+// fullHealth gathers everything needed to debug a bad run in one response.
+type fullHealth struct {
+	InstanceID string                      `json:"instanceId,omitempty"`
+	Database   map[string]string           `json:"database"`
+	Strategy   string                      `json:"strategy"`
+	Processors []processors.ProcessorState `json:"processors"`
+	Workers    int                         `json:"workers"`
+	Queues     workers.QueueStats          `json:"queues"`
+	Deferred   int                         `json:"deferredPayments"`
+	SLA        metrics.LatencySnapshot     `json:"sla"`
+}
+
+func (s *Server) fullHealthHandler(c echo.Context) error {
+	health := fullHealth{
+		Database:   s.db.Health(),
+		Strategy:   s.processors.Strategy().Name(),
+		Processors: s.processors.States(),
+		Workers:    s.workerPool.Workers(),
+		Queues:     s.workerPool.QueueStats(),
+		SLA:        s.workerPool.SLASnapshot(),
+	}
+	if s.registry != nil {
+		health.InstanceID = s.registry.ID()
+	}
+	if s.deferred != nil {
+		health.Deferred = s.deferred.size()
+	}
+
+	status := http.StatusOK
+	if health.Database["status"] != "up" {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, health)
+}
+
+func (s *Server) processorHealthHistoryHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.processors.HealthHistory())
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+)
+
+// apiActor is the history actor for transitions made while serving requests.
+const apiActor = "api"
+
+// recordAPIEvent appends a transition made by the API to the payment history,
+// logging instead of failing the request when the write fails.
+func recordAPIEvent(ctx context.Context, db database.Service, paymentID uuid.UUID, status models.PaymentStatus, errText string) {
+	event := models.PaymentEvent{PaymentID: paymentID, Status: status, Actor: apiActor}
+	if errText != "" {
+		event.Error = &errText
+	}
+
+	if err := db.RecordPaymentEvent(ctx, event); err != nil {
+		slog.WarnContext(ctx, "failed to record payment event", "paymentId", paymentID, "status", status, "actor", apiActor, "error", err)
+	}
+}
+
+// paymentHistoryHandler returns the status transitions of a payment, oldest
+// first.
+func (s *Server) paymentHistoryHandler(c echo.Context) error {
+	paymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid payment id")
+	}
+
+	ctx := c.Request().Context()
+	payment, err := s.db.GetPayment(ctx, paymentID)
+	if err == nil {
+		if tenant := tenantFromContext(c); tenant != nil && (payment.TenantID == nil || *payment.TenantID != *tenant) {
+			err = database.ErrPaymentNotFound
+		}
+	}
+	if errors.Is(err, database.ErrPaymentNotFound) {
+		return apiError(http.StatusNotFound, models.ErrorCodeNotFound, "Payment not found")
+	}
+	if err != nil {
+		slog.Error("failed to get payment", "paymentId", paymentID, "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to get payment")
+	}
+
+	events, err := s.db.GetPaymentHistory(ctx, paymentID)
+	if err != nil {
+		slog.Error("failed to get payment history", "paymentId", paymentID, "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to get payment history")
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/models"
+)
+
+// maxPooledBufferBytes keeps unusually large responses from pinning memory
+// in the pool.
+const maxPooledBufferBytes = 64 << 10
+
+var jsonBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getJSONBuffer() *bytes.Buffer {
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putJSONBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferBytes {
+		jsonBuffers.Put(buf)
+	}
+}
+
+// pooledJSONSerializer encodes responses into pooled buffers, writing each in
+// a single call, and decodes payment requests with the raw handler's
+// reflection-free scanner. Other request bodies go through encoding/json.
+type pooledJSONSerializer struct{}
+
+func (pooledJSONSerializer) Serialize(c echo.Context, i any, indent string) error {
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	enc := json.NewEncoder(buf)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(i); err != nil {
+		return err
+	}
+	_, err := c.Response().Write(buf.Bytes())
+	return err
+}
+
+func (pooledJSONSerializer) Deserialize(c echo.Context, i any) error {
+	req, ok := i.(*models.PaymentRequest)
+	if !ok {
+		return echo.DefaultJSONSerializer{}.Deserialize(c, i)
+	}
+
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	if _, err := buf.ReadFrom(io.LimitReader(c.Request().Body, maxPaymentBodyBytes)); err != nil {
+		return err
+	}
+	decoded, err := decodePaymentRequest(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	*req = decoded
+	return nil
+}
+
+// newJSONSerializer picks echo's JSON implementation from JSON_SERIALIZER:
+// "std" (default, encoding/json as echo ships it) or "pooled".
+func newJSONSerializer() echo.JSONSerializer {
+	switch mode := os.Getenv("JSON_SERIALIZER"); mode {
+	case "", "std":
+		return echo.DefaultJSONSerializer{}
+	case "pooled":
+		return pooledJSONSerializer{}
+	default:
+		slog.Warn("ignoring JSON_SERIALIZER", "value", mode)
+		return echo.DefaultJSONSerializer{}
+	}
+}
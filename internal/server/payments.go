@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"rinha-backend-2025/internal/currency"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/logging"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/workers"
+)
+
+// The payment and summary logic is shared by the echo handlers and the raw
+// net/http fast path, so both return a status code and a JSON body instead of
+// writing the response themselves.
+
+const (
+	// strongConsistencyWait bounds how long consistency=strong holds a
+	// summary request while the queue drains.
+	strongConsistencyWait = 2 * time.Second
+	drainPollInterval     = 5 * time.Millisecond
+)
+
+// paymentPool recycles the Payment built for each request. A payment only
+// goes back once it is written and queued: the batch writer may still fill in
+// one whose insert timed out, and the deferred buffer keeps the ones it takes.
+var paymentPool = sync.Pool{
+	New: func() any { return new(models.Payment) },
+}
+
+func releasePayment(payment *models.Payment) {
+	*payment = models.Payment{}
+	paymentPool.Put(payment)
+}
+
+// acceptPayment validates, records and queues a decoded payment request.
+func (s *Server) acceptPayment(ctx context.Context, req models.PaymentRequest, tenant *string) (int, any) {
+	// Errors carry the correlationId so clients can match them to the
+	// payment they sent
+	fail := func(status int, code, message string) (int, any) {
+		return status, apiError(status, code, message).WithCorrelationID(req.CorrelationID)
+	}
+
+	if fields := s.validatePaymentRequest(req); fields != nil {
+		status, body := validationFailed(fields)
+		if req.CorrelationID != uuid.Nil {
+			body.WithCorrelationID(req.CorrelationID)
+		}
+		return status, body
+	}
+
+	amount, err := s.converter.ToBase(ctx, req.Amount, req.Currency)
+	if err != nil {
+		return fail(http.StatusBadRequest, models.ErrorCodeUnsupportedCurrency, "Unsupported currency")
+	}
+	if fields := s.exceedsMaxAmount(amount); fields != nil {
+		status, body := validationFailed(fields)
+		return status, body.WithCorrelationID(req.CorrelationID)
+	}
+
+	// Shed load up front rather than accept payments that would sit in the
+	// backlog past the point where processing them is still useful.
+	if s.workerPool.QueueLength() >= s.maxQueueDepth() {
+		return fail(http.StatusTooManyRequests, models.ErrorCodeTooManyPending, "Too many pending payments")
+	}
+
+	payment := paymentPool.Get().(*models.Payment)
+	*payment = models.Payment{
+		CorrelationID:  req.CorrelationID,
+		Amount:         amount,
+		Currency:       s.converter.Base(),
+		OriginalAmount: req.Amount,
+		TenantID:       tenant,
+		Status:         models.PaymentStatusPending,
+		RequestedAt:    time.Now().UTC(),
+	}
+	if s.registry != nil {
+		owner := s.registry.ID()
+		payment.OwnerInstance = &owner
+	}
+	if req.Currency != "" {
+		payment.Currency = currency.Normalize(req.Currency)
+	}
+	if req.CallbackURL != "" {
+		payment.CallbackURL = &req.CallbackURL
+	}
+
+	if s.insertMode == insertInWorker {
+		return s.queueUnsavedPayment(ctx, payment, fail)
+	}
+
+	logging.HotPathContext(ctx, "creating payment", "correlationId", payment.CorrelationID, "requestedAt", payment.RequestedAt)
+
+	if err := s.db.CreatePayment(ctx, payment); err != nil {
+		if errors.Is(err, database.ErrDuplicateCorrelationID) {
+			return s.duplicatePayment(ctx, req.CorrelationID, tenant)
+		}
+		if database.IsUnavailable(err) && s.deferred != nil && s.deferred.add(payment) {
+			return http.StatusAccepted, models.PaymentResponse{Message: "Payment accepted for processing"}
+		}
+		return fail(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to process payment")
+	}
+	defer releasePayment(payment)
+	s.summaryCache.invalidate()
+
+	logging.HotPathContext(ctx, "submitting payment to worker", "paymentId", payment.ID, "correlationId", payment.CorrelationID)
+
+	if err := s.workerPool.SubmitPayment(*payment); err != nil {
+		if errors.Is(err, workers.ErrQueueFull) {
+			// The queue filled up after the check above. The client is told
+			// the payment was refused, so remove it: nothing may charge it
+			// later and a retry with the same correlationId starts afresh.
+			if deleteErr := s.db.DeletePayment(ctx, payment.ID); deleteErr != nil {
+				slog.ErrorContext(ctx, "failed to delete unqueued payment", "paymentId", payment.ID, "correlationId", payment.CorrelationID, "error", deleteErr)
+			}
+			s.summaryCache.invalidate()
+			return fail(http.StatusServiceUnavailable, models.ErrorCodeQueueFull, "Payment queue is full")
+		}
+		if errors.Is(err, workers.ErrPoolStopped) {
+			// The payment stays pending and is reclaimed with the rest of
+			// this instance's once it has stopped
+			slog.WarnContext(ctx, "worker pool stopping, leaving payment for reclaim", "paymentId", payment.ID, "correlationId", payment.CorrelationID)
+			return http.StatusAccepted, models.PaymentResponse{Message: "Payment accepted for processing"}
+		}
+		return fail(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to submit payment for processing")
+	}
+
+	return http.StatusAccepted, models.PaymentResponse{Message: "Payment accepted for processing"}
+}
+
+// queueUnsavedPayment hands the payment to the workers without writing it,
+// for PAYMENT_INSERT_MODE=worker. Duplicates can't be detected here: they are
+// accepted and dropped by the worker when the insert hits the unique index.
+func (s *Server) queueUnsavedPayment(ctx context.Context, payment *models.Payment, fail func(int, string, string) (int, any)) (int, any) {
+	defer releasePayment(payment)
+
+	logging.HotPathContext(ctx, "submitting unsaved payment to worker", "correlationId", payment.CorrelationID)
+
+	if err := s.workerPool.SubmitUnsaved(*payment); err != nil {
+		if errors.Is(err, workers.ErrQueueFull) {
+			return fail(http.StatusServiceUnavailable, models.ErrorCodeQueueFull, "Payment queue is full")
+		}
+		if errors.Is(err, workers.ErrPoolStopped) {
+			return fail(http.StatusServiceUnavailable, models.ErrorCodeInternal, "Server is shutting down")
+		}
+		return fail(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to submit payment for processing")
+	}
+
+	return http.StatusAccepted, models.PaymentResponse{Message: "Payment accepted for processing"}
+}
+
+// duplicatePayment answers a resubmitted correlationId according to
+// DUPLICATE_PAYMENT_MODE: the existing payment with 200 (replay) or 409 with
+// its ID (conflict). A payment owned by another tenant gets a bare 409.
+func (s *Server) duplicatePayment(ctx context.Context, correlationID uuid.UUID, tenant *string) (int, any) {
+	existing, err := s.db.GetPaymentByCorrelationID(ctx, correlationID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load duplicate payment", "correlationId", correlationID, "error", err)
+		return errorResult(http.StatusConflict, models.ErrorCodeDuplicatePayment, "Payment already exists")
+	}
+	if tenant != nil && (existing.TenantID == nil || *existing.TenantID != *tenant) {
+		return errorResult(http.StatusConflict, models.ErrorCodeDuplicatePayment, "Payment already exists")
+	}
+
+	if s.duplicateMode == duplicateConflict {
+		return http.StatusConflict, apiError(http.StatusConflict, models.ErrorCodeDuplicatePayment, "Payment already exists").
+			WithDetails(map[string]string{"paymentId": existing.ID.String()})
+	}
+	return http.StatusOK, existing
+}
+
+// paymentsSummary aggregates payments between the optional RFC 3339 from and
+// to bounds. Fee totals are only included with includeFees=true, since the
+// contest checker expects the plain totals. With consistency=strong it first
+// waits, up to strongConsistencyWait, for the local queue to drain.
+func (s *Server) paymentsSummary(ctx context.Context, query url.Values, tenant *string) (int, any) {
+	fromStr, toStr := query.Get("from"), query.Get("to")
+
+	var strong bool
+	switch query.Get("consistency") {
+	case "", "eventual":
+	case "strong":
+		strong = true
+	default:
+		return errorResult(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid consistency. Use eventual or strong")
+	}
+
+	logging.HotPathContext(ctx, "payments summary requested", "from", fromStr, "to", toStr)
+
+	var startDate, endDate *time.Time
+
+	if fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			slog.DebugContext(ctx, "invalid from parameter", "from", fromStr)
+			return errorResult(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid from format. Use ISO 8601 format (e.g., 2020-07-10T12:34:56.000Z)")
+		}
+		startDate = &parsed
+	}
+
+	if toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			slog.DebugContext(ctx, "invalid to parameter", "to", toStr)
+			return errorResult(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid to format. Use ISO 8601 format (e.g., 2020-07-10T12:34:56.000Z)")
+		}
+		endDate = &parsed
+	}
+
+	// Only wait once the request is known to be valid
+	cache := s.summaryCache
+	if strong {
+		s.waitForDrain(ctx)
+		cache = nil
+	}
+
+	summary, err := s.cachedPaymentSummary(ctx, cache, startDate, endDate, tenant, summaryKey{from: fromStr, to: toStr})
+	if err != nil {
+		// The cause may carry database details, so it only goes to the log
+		slog.ErrorContext(ctx, "failed to get payment summary", "from", fromStr, "to", toStr, "error", err)
+		return errorResult(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to get payment summary")
+	}
+
+	if includeFees, _ := strconv.ParseBool(query.Get("includeFees")); !includeFees {
+		summary = maps.Clone(summary)
+		for processor, totals := range summary {
+			totals.TotalFee, totals.NetAmount = nil, nil
+			summary[processor] = totals
+		}
+	}
+
+	logging.HotPathContext(ctx, "payments summary computed", "summary", summary)
+
+	return http.StatusOK, summary
+}
+
+// cachedPaymentSummary reads the summary through cache when it isn't nil.
+// The result may be shared with the cache and must be cloned before being
+// modified.
+func (s *Server) cachedPaymentSummary(ctx context.Context, cache *summaryCache, startDate, endDate *time.Time, tenant *string, key summaryKey) (models.PaymentSummaryResponse, error) {
+	if cache == nil {
+		return s.db.GetPaymentSummary(ctx, startDate, endDate, tenant)
+	}
+
+	if tenant != nil {
+		key.tenant = *tenant
+	}
+	summary, generation, ok := cache.get(key)
+	if ok {
+		return summary, nil
+	}
+	summary, err := s.db.GetPaymentSummary(ctx, startDate, endDate, tenant)
+	if err != nil {
+		return nil, err
+	}
+	cache.put(key, generation, summary)
+	return summary, nil
+}
+
+// waitForDrain blocks until every payment accepted by this instance has been
+// processed, the wait times out or ctx is done. Payments still in flight on
+// other instances are not waited for.
+func (s *Server) waitForDrain(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, strongConsistencyWait)
+	defer cancel()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !s.drained() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "answering strong summary before the queue drained", "queueLength", s.workerPool.QueueLength())
+			return
+		}
+	}
+}
+
+func (s *Server) drained() bool {
+	if s.deferred != nil && s.deferred.size() > 0 {
+		return false
+	}
+	return s.workerPool.Idle()
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// maxPaymentBodyBytes bounds what the raw handler reads for POST /payments.
+const maxPaymentBodyBytes = 4 << 10
+
+// rawHandler serves POST /payments and GET /payments-summary (and their /v1
+// aliases) with plain net/http and no middleware, handing every other request
+// to next. It is enabled with HTTP_MODE=raw.
+type rawHandler struct {
+	s    *Server
+	next http.Handler
+}
+
+func (s *Server) newRawHandler(next http.Handler) http.Handler {
+	return &rawHandler{s: s, next: next}
+}
+
+func (h *rawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && (r.URL.Path == "/payments" || r.URL.Path == "/v1/payments"):
+		h.createPayment(w, r)
+	case r.Method == http.MethodGet && (r.URL.Path == "/payments-summary" || r.URL.Path == "/v1/payments-summary"):
+		h.paymentsSummary(w, r)
+	default:
+		h.next.ServeHTTP(w, r)
+	}
+}
+
+func (h *rawHandler) createPayment(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.s.resolveTenant(r.Header)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Missing or invalid API key"))
+		return
+	}
+
+	body := getJSONBuffer()
+	defer putJSONBuffer(body)
+
+	if _, err := body.ReadFrom(io.LimitReader(r.Body, maxPaymentBodyBytes)); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid request format"))
+		return
+	}
+
+	req, err := decodePaymentRequest(body.Bytes())
+	if err != nil {
+		status, resp := bindErrorResponse(err)
+		writeJSON(w, status, resp)
+		return
+	}
+
+	status, resp := h.s.acceptPayment(r.Context(), req, tenant)
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+	writeJSON(w, status, resp)
+}
+
+func (h *rawHandler) paymentsSummary(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.s.resolveTenant(r.Header)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Missing or invalid API key"))
+		return
+	}
+
+	status, resp := h.s.paymentsSummary(r.Context(), r.URL.Query(), tenant)
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		status = http.StatusInternalServerError
+		buf.Reset()
+		buf.WriteString(`{"code":"internal_error","error":"Failed to encode response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// decodePaymentRequest parses the flat payment object the load test sends
+// without reflection, falling back to encoding/json for any input the fast
+// path does not handle.
+func decodePaymentRequest(data []byte) (models.PaymentRequest, error) {
+	var req models.PaymentRequest
+	if handled, err := scanPaymentRequest(data, &req); handled {
+		return req, err
+	}
+
+	req = models.PaymentRequest{}
+	err := json.Unmarshal(data, &req)
+	return req, err
+}
+
+// scanPaymentRequest reports handled=false for anything but a flat object of
+// known keys with escape-free strings and plain number values.
+func scanPaymentRequest(data []byte, req *models.PaymentRequest) (handled bool, err error) {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false, nil
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return skipSpace(data, i+1) == len(data), nil
+	}
+
+	for {
+		key, next, ok := scanString(data, i)
+		if !ok {
+			return false, nil
+		}
+		i = skipSpace(data, next)
+		if i >= len(data) || data[i] != ':' {
+			return false, nil
+		}
+		i = skipSpace(data, i+1)
+
+		var value []byte
+		quoted := i < len(data) && data[i] == '"'
+		if quoted {
+			if value, next, ok = scanString(data, i); !ok {
+				return false, nil
+			}
+		} else {
+			next = i
+			for next < len(data) && isNumberByte(data[next]) {
+				next++
+			}
+			value = data[i:next]
+		}
+		i = skipSpace(data, next)
+
+		switch {
+		case string(key) == "correlationId" && quoted:
+			if req.CorrelationID, err = uuid.ParseBytes(value); err != nil {
+				return true, err
+			}
+		case string(key) == "amount" && len(value) > 0:
+			if err := req.Amount.UnmarshalJSON(value); err != nil {
+				return true, err
+			}
+		case string(key) == "currency" && quoted:
+			req.Currency = string(value)
+		case string(key) == "callbackUrl" && quoted:
+			req.CallbackURL = string(value)
+		default:
+			return false, nil
+		}
+
+		if i >= len(data) {
+			return false, nil
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case '}':
+			return skipSpace(data, i+1) == len(data), nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+// scanString returns the contents of the string starting at data[i] and the
+// index after its closing quote. Strings with escapes are not handled.
+func scanString(data []byte, i int) ([]byte, int, bool) {
+	if i >= len(data) || data[i] != '"' {
+		return nil, i, false
+	}
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '"':
+			return data[i+1 : j], j + 1, true
+		case '\\':
+			return nil, i, false
+		}
+	}
+	return nil, i, false
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func isNumberByte(b byte) bool {
+	return (b >= '0' && b <= '9') || b == '-' || b == '+' || b == '.' || b == 'e' || b == 'E'
+}
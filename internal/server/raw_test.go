@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+func TestDecodePaymentRequest(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name    string
+		body    string
+		want    models.PaymentRequest
+		wantErr error
+	}{
+		{"fast path", `{"correlationId":"` + id.String() + `","amount":19.90}`, models.PaymentRequest{CorrelationID: id, Amount: 1990}, nil},
+		{"whitespace and currency", "{ \"amount\" : 5 ,\n \"correlationId\": \"" + id.String() + "\", \"currency\": \"USD\" }", models.PaymentRequest{CorrelationID: id, Amount: 500, Currency: "USD"}, nil},
+		{"string amount", `{"correlationId":"` + id.String() + `","amount":"0.01"}`, models.PaymentRequest{CorrelationID: id, Amount: 1}, nil},
+		{"unknown key falls back", `{"correlationId":"` + id.String() + `","amount":1,"note":"x"}`, models.PaymentRequest{CorrelationID: id, Amount: 100}, nil},
+		{"escaped string falls back", `{"correlationId":"` + id.String() + `","amount":1,"currency":"U\u0053D"}`, models.PaymentRequest{CorrelationID: id, Amount: 100, Currency: "USD"}, nil},
+		{"sub-cent amount", `{"correlationId":"` + id.String() + `","amount":1.001}`, models.PaymentRequest{}, models.ErrMoneyPrecision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePaymentRequest([]byte(tt.body))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePaymentRequest() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decodePaymentRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, body := range []string{``, `[]`, `{"correlationId":"nope","amount":1}`, `{"amount":1`} {
+		if _, err := decodePaymentRequest([]byte(body)); err == nil {
+			t.Errorf("expected error for %q", body)
+		}
+	}
+}
+
+var benchSink any
+
+// The benchmarks below compare each pooled hot-path allocation with the
+// plain one it replaced; run them with -benchmem.
+
+func BenchmarkWriteJSON(b *testing.B) {
+	body := models.PaymentSummaryResponse{
+		"default":  {TotalRequests: 1200, TotalAmount: 2388000},
+		"fallback": {TotalRequests: 300, TotalAmount: 597000},
+	}
+
+	w := &discardResponseWriter{header: http.Header{}}
+
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := json.Marshal(body)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(data)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writeJSON(w, http.StatusOK, body)
+		}
+	})
+}
+
+func BenchmarkReadPaymentBody(b *testing.B) {
+	body := []byte(`{"correlationId":"` + uuid.NewString() + `","amount":19.90}`)
+
+	b.Run("readAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := io.ReadAll(bytes.NewReader(body))
+			benchSink, _ = decodePaymentRequest(data)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := getJSONBuffer()
+			buf.ReadFrom(bytes.NewReader(body))
+			benchSink, _ = decodePaymentRequest(buf.Bytes())
+			putJSONBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkPaymentAllocation(b *testing.B) {
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			benchSink = &models.Payment{CorrelationID: uuid.Nil, Amount: 1990}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			payment := paymentPool.Get().(*models.Payment)
+			*payment = models.Payment{CorrelationID: uuid.Nil, Amount: 1990}
+			releasePayment(payment)
+		}
+	})
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
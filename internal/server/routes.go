@@ -1,35 +1,98 @@
 package server
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"time"
+	"os"
+	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/logging"
 	"rinha-backend-2025/internal/models"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	e := echo.New()
+	e.HTTPErrorHandler = s.httpErrorHandler
+	e.JSONSerializer = newJSONSerializer()
+	useMiddlewareProfile(e, os.Getenv("MIDDLEWARE_PROFILE"))
+
+	e.GET("/", s.HelloWorldHandler)
+	e.GET("/health", s.healthHandler)
+	e.GET("/health/full", s.fullHealthHandler, s.adminAuthMiddleware)
+
+	admin := e.Group("/admin", s.adminAuthMiddleware)
+	admin.GET("/metrics/sla", s.slaMetricsHandler)
+	admin.GET("/queues", s.queueStatsHandler)
+	admin.GET("/stats", s.liveStatsHandler)
+	admin.GET("/processors/health", s.processorHealthHistoryHandler)
+	admin.POST("/dlq/requeue", s.dlqRequeueHandler)
+	admin.POST("/workers/pause", s.pauseWorkersHandler)
+	admin.POST("/workers/resume", s.resumeWorkersHandler)
+	admin.POST("/config", s.reloadConfigHandler)
+	admin.GET("/logging", s.getLogSettingsHandler)
+	admin.PUT("/logging", s.updateLogSettingsHandler)
+	admin.DELETE("/payments", s.clearPaymentsHandler)
+
+	s.registerV1Routes(e.Group("/v1"))
+
+	// Unversioned aliases of v1, kept because the contest checker calls these paths.
+	s.registerV1Routes(e.Group(""))
+
+	return e
+}
+
+// useMiddlewareProfile installs the optional middleware of a profile: "dev"
+// (default) logs every request, tags it with a request ID and allows CORS;
+// "perf" only recovers from panics, for load tests where the rest is overhead.
+func useMiddlewareProfile(e *echo.Echo, profile string) {
+	switch profile {
+	case "", "dev":
+	case "perf":
+		e.Use(middleware.Recover())
+		return
+	default:
+		slog.Warn("unknown MIDDLEWARE_PROFILE, using dev", "value", profile)
+	}
+
+	e.Use(requestIDMiddleware())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"https://*", "http://*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", apiKeyHeader, adminTokenHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+}
 
-	e.GET("/", s.HelloWorldHandler)
-	e.GET("/health", s.healthHandler)
-	e.POST("/payments", s.createPaymentHandler)
-	e.GET("/payments-summary", s.paymentsSummaryHandler)
-	e.DELETE("/payments", s.clearPaymentsHandler)
+// requestIDMiddleware keeps the caller's X-Request-Id or generates one, echoes
+// it in the response and puts it in the request context so log lines written
+// with that context carry it.
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+		},
+	})
+}
 
-	return e
+// registerV1Routes registers the v1 payment API on g. A future version gets
+// its own register function and handlers so both can be mounted side by side.
+// The tenant middleware is added per route: on the group it would also answer
+// unknown paths.
+func (s *Server) registerV1Routes(g *echo.Group) {
+	g.POST("/payments", s.createPaymentHandler, s.tenantMiddleware)
+	g.GET("/payments-summary", s.paymentsSummaryHandler, s.tenantMiddleware)
+	g.GET("/payments/:id", s.getPaymentHandler, s.tenantMiddleware)
+	g.GET("/payments/by-correlation/:correlationId", s.getPaymentByCorrelationHandler, s.tenantMiddleware)
+	g.POST("/payments/:id/cancel", s.cancelPaymentHandler, s.tenantMiddleware)
+	g.GET("/payments/:id/history", s.paymentHistoryHandler, s.tenantMiddleware)
 }
 
 func (s *Server) HelloWorldHandler(c echo.Context) error {
@@ -41,96 +104,117 @@ func (s *Server) HelloWorldHandler(c echo.Context) error {
 }
 
 func (s *Server) healthHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, s.db.Health())
+	stats := s.db.Health()
+	if stats["status"] != "up" {
+		return c.JSON(http.StatusServiceUnavailable, stats)
+	}
+	return c.JSON(http.StatusOK, stats)
 }
 
 func (s *Server) createPaymentHandler(c echo.Context) error {
 	var req models.PaymentRequest
 	
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
-	}
-	
-	if req.Amount <= 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Amount must be greater than 0"})
+		status, body := bindErrorResponse(err)
+		return c.JSON(status, body)
 	}
 	
-	requestedAt := time.Now().UTC()
-	payment := &models.Payment{
-		CorrelationID: req.CorrelationID,
-		Amount:        req.Amount,
-		Status:        models.PaymentStatusPending,
-		RequestedAt:   requestedAt,
+	status, body := s.acceptPayment(c.Request().Context(), req, tenantFromContext(c))
+	if status == http.StatusTooManyRequests {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
 	}
-	
-	log.Printf("Creating payment with RequestedAt: %v", payment.RequestedAt)
-	
-	if err := s.db.CreatePayment(c.Request().Context(), payment); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process payment"})
-	}
-	
-	log.Printf("Submitting payment to worker with RequestedAt: %v", payment.RequestedAt)
-	
-	if err := s.workerPool.SubmitPayment(payment.ID, payment.CorrelationID, payment.Amount, payment.RequestedAt); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to submit payment for processing"})
+	return c.JSON(status, body)
+}
+
+func (s *Server) getPaymentHandler(c echo.Context) error {
+	paymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid payment id")
 	}
 	
-	response := models.PaymentResponse{
-		Message: "Payment accepted for processing",
+	payment, err := s.db.GetPayment(c.Request().Context(), paymentID)
+	return s.paymentLookupResponse(c, payment, err)
+}
+
+func (s *Server) getPaymentByCorrelationHandler(c echo.Context) error {
+	correlationID, err := uuid.Parse(c.Param("correlationId"))
+	if err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid correlationId")
 	}
 	
-	return c.JSON(http.StatusAccepted, response)
+	payment, err := s.db.GetPaymentByCorrelationID(c.Request().Context(), correlationID)
+	return s.paymentLookupResponse(c, payment, err)
 }
 
-func (s *Server) paymentsSummaryHandler(c echo.Context) error {
-	log.Printf("paymentsSummaryHandler called")
-	
-	fromStr := c.QueryParam("from")
-	toStr := c.QueryParam("to")
-	
-	log.Printf("Query params - from: %s, to: %s", fromStr, toStr)
-	
-	var startDate, endDate *time.Time
-	
-	if fromStr != "" {
-		if parsed, err := time.Parse(time.RFC3339, fromStr); err == nil {
-			startDate = &parsed
-		} else {
-			log.Printf("Invalid from format: %s", fromStr)
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from format. Use ISO 8601 format (e.g., 2020-07-10T12:34:56.000Z)"})
-		}
+// cancelPaymentHandler cancels a payment that is still waiting in the queue.
+// Its job stays queued but is skipped when a worker picks it up.
+func (s *Server) cancelPaymentHandler(c echo.Context) error {
+	paymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return apiError(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid payment id")
 	}
 	
-	if toStr != "" {
-		if parsed, err := time.Parse(time.RFC3339, toStr); err == nil {
-			endDate = &parsed
+	ctx := c.Request().Context()
+	payment, err := s.db.GetPayment(ctx, paymentID)
+	if err == nil {
+		if tenant := tenantFromContext(c); tenant != nil && (payment.TenantID == nil || *payment.TenantID != *tenant) {
+			err = database.ErrPaymentNotFound
 		} else {
-			log.Printf("Invalid to format: %s", toStr)
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to format. Use ISO 8601 format (e.g., 2020-07-10T12:34:56.000Z)"})
+			err = s.db.CancelPayment(ctx, paymentID)
 		}
 	}
 	
-	log.Printf("Calling GetPaymentSummary with startDate: %v, endDate: %v", startDate, endDate)
+	switch {
+	case errors.Is(err, database.ErrPaymentNotFound):
+		return apiError(http.StatusNotFound, models.ErrorCodeNotFound, "Payment not found")
+	case errors.Is(err, database.ErrPaymentNotCancellable):
+		return apiError(http.StatusConflict, models.ErrorCodePaymentNotCancellable, "Payment processing has already started")
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to cancel payment", "paymentId", paymentID, "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to cancel payment")
+	}
+	recordAPIEvent(ctx, s.db, paymentID, models.PaymentStatusCancelled, "")
 	
-	summary, err := s.db.GetPaymentSummary(c.Request().Context(), startDate, endDate)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Payment cancelled"})
+}
+
+func (s *Server) paymentLookupResponse(c echo.Context, payment *models.Payment, err error) error {
+	if errors.Is(err, database.ErrPaymentNotFound) {
+		return apiError(http.StatusNotFound, models.ErrorCodeNotFound, "Payment not found")
+	}
 	if err != nil {
-		log.Printf("Error from GetPaymentSummary: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get payment summary", "details": err.Error()})
+		slog.ErrorContext(c.Request().Context(), "failed to get payment", "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to get payment")
 	}
 	
-	log.Printf("GetPaymentSummary returned summary: %+v", summary)
+	// Tenants only see their own payments
+	if tenant := tenantFromContext(c); tenant != nil && (payment.TenantID == nil || *payment.TenantID != *tenant) {
+		return apiError(http.StatusNotFound, models.ErrorCodeNotFound, "Payment not found")
+	}
 	
-	return c.JSON(http.StatusOK, summary)
+	return c.JSON(http.StatusOK, payment)
+}
+
+func (s *Server) paymentsSummaryHandler(c echo.Context) error {
+	status, body := s.paymentsSummary(c.Request().Context(), c.QueryParams(), tenantFromContext(c))
+	return c.JSON(status, body)
 }
 
 func (s *Server) clearPaymentsHandler(c echo.Context) error {
-	log.Printf("clearPaymentsHandler called")
-	
 	err := s.db.ClearPayments(c.Request().Context())
+	s.summaryCache.invalidate()
 	if err != nil {
-		log.Printf("Error clearing payments: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to clear payments"})
+		slog.ErrorContext(c.Request().Context(), "failed to clear payments", "error", err)
+		return apiError(http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to clear payments")
 	}
 	
 	return c.JSON(http.StatusOK, map[string]string{"message": "All payments cleared successfully"})
 }
+
+func (s *Server) slaMetricsHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.workerPool.SLASnapshot())
+}
+
+func (s *Server) queueStatsHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.workerPool.QueueStats())
+}
@@ -1,12 +1,25 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"rinha-backend-2025/internal/currency"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/processors"
+	"rinha-backend-2025/internal/workers"
 )
 
 func TestHandler(t *testing.T) {
@@ -37,3 +50,505 @@ func TestHandler(t *testing.T) {
 		return
 	}
 }
+
+func TestV1RoutesMirrorLegacyRoutes(t *testing.T) {
+	s := &Server{}
+	e, ok := s.RegisterRoutes().(*echo.Echo)
+	if !ok {
+		t.Fatal("RegisterRoutes() did not return an *echo.Echo")
+	}
+
+	registered := make(map[string]bool)
+	for _, r := range e.Routes() {
+		registered[r.Method+" "+r.Path] = true
+	}
+
+	for _, route := range []string{"POST /payments", "GET /payments-summary", "GET /payments/:id"} {
+		method, path, _ := strings.Cut(route, " ")
+		if !registered[method+" "+path] {
+			t.Errorf("legacy route %s not registered", route)
+		}
+		if !registered[method+" /v1"+path] {
+			t.Errorf("versioned route %s /v1%s not registered", method, path)
+		}
+	}
+}
+
+type stubDB struct {
+	database.Service
+	payments map[uuid.UUID]*models.Payment
+	events   []models.PaymentEvent
+	// summaryErr, when set, fails GetPaymentSummary
+	summaryErr error
+}
+
+func (db *stubDB) RecordPaymentEvent(_ context.Context, event models.PaymentEvent) error {
+	db.events = append(db.events, event)
+	return nil
+}
+
+func (db *stubDB) GetPaymentHistory(_ context.Context, paymentID uuid.UUID) ([]models.PaymentEvent, error) {
+	var events []models.PaymentEvent
+	for _, event := range db.events {
+		if event.PaymentID == paymentID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (db *stubDB) GetPayment(_ context.Context, paymentID uuid.UUID) (*models.Payment, error) {
+	payment, ok := db.payments[paymentID]
+	if !ok {
+		return nil, database.ErrPaymentNotFound
+	}
+	return payment, nil
+}
+
+func (db *stubDB) GetPaymentByCorrelationID(_ context.Context, correlationID uuid.UUID) (*models.Payment, error) {
+	for _, payment := range db.payments {
+		if payment.CorrelationID == correlationID {
+			return payment, nil
+		}
+	}
+	return nil, database.ErrPaymentNotFound
+}
+
+func (db *stubDB) GetPaymentSummary(_ context.Context, _, _ *time.Time, _ *string) (models.PaymentSummaryResponse, error) {
+	if db.summaryErr != nil {
+		return nil, db.summaryErr
+	}
+	fee, net := models.Money(50), models.Money(950)
+	return models.PaymentSummaryResponse{
+		"default": {TotalRequests: 1, TotalAmount: 1000, TotalFee: &fee, NetAmount: &net},
+	}, nil
+}
+
+func (db *stubDB) CancelPayment(_ context.Context, paymentID uuid.UUID) error {
+	payment, ok := db.payments[paymentID]
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+	if payment.Status != models.PaymentStatusPending {
+		return database.ErrPaymentNotCancellable
+	}
+	payment.Status = models.PaymentStatusCancelled
+	return nil
+}
+
+func TestGetPaymentHandler(t *testing.T) {
+	payment := &models.Payment{
+		ID:            uuid.New(),
+		CorrelationID: uuid.New(),
+		Amount:        1990,
+		Status:        models.PaymentStatusCompleted,
+	}
+	s := &Server{db: &stubDB{payments: map[uuid.UUID]*models.Payment{payment.ID: payment}}}
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"found", "/payments/" + payment.ID.String(), http.StatusOK},
+		{"versioned", "/v1/payments/" + payment.ID.String(), http.StatusOK},
+		{"not found", "/payments/" + uuid.NewString(), http.StatusNotFound},
+		{"invalid id", "/payments/not-a-uuid", http.StatusBadRequest},
+		{"by correlation", "/payments/by-correlation/" + payment.CorrelationID.String(), http.StatusOK},
+		{"by unknown correlation", "/payments/by-correlation/" + uuid.NewString(), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d (%s)", tt.wantStatus, resp.Code, resp.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got models.Payment
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response body: %v", err)
+			}
+			if got.ID != payment.ID || got.Status != payment.Status {
+				t.Errorf("unexpected payment in response: %+v", got)
+			}
+		})
+	}
+}
+
+func TestCreatePaymentShedsLoadWhenQueueSaturated(t *testing.T) {
+	pool := workers.NewPaymentWorkerPool(1, 1, nil, nil)
+	if err := pool.SubmitPayment(models.Payment{ID: uuid.New(), CorrelationID: uuid.New(), Amount: 1000, RequestedAt: time.Now()}); err != nil {
+		t.Fatalf("SubmitPayment() error = %v", err)
+	}
+
+	rates := currency.NewStaticRateProvider(nil)
+	s := &Server{workerPool: pool, converter: currency.NewConverter("BRL", rates, rates)}
+	handler := s.RegisterRoutes()
+
+	body := `{"correlationId": "` + uuid.NewString() + `", "amount": 19.90}`
+	req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusTooManyRequests, resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+}
+
+func TestCreatePaymentValidation(t *testing.T) {
+	rates := currency.NewStaticRateProvider(map[string]float64{"USD": 5})
+	s := &Server{
+		workerPool:       workers.NewPaymentWorkerPool(1, 1, nil, nil),
+		converter:        currency.NewConverter("BRL", rates, rates),
+		maxPaymentAmount: 100000,
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+	}{
+		{"nil correlationId", `{"correlationId": "00000000-0000-0000-0000-000000000000", "amount": 10}`, "correlationId"},
+		{"zero amount", `{"correlationId": "` + uuid.NewString() + `", "amount": 0}`, "amount"},
+		{"sub-cent amount", `{"correlationId": "` + uuid.NewString() + `", "amount": 10.001}`, "amount"},
+		{"above maximum", `{"correlationId": "` + uuid.NewString() + `", "amount": 1000.01}`, "amount"},
+		{"above maximum once converted", `{"correlationId": "` + uuid.NewString() + `", "amount": 200.01, "currency": "USD"}`, "amount"},
+	}
+
+	for _, serializer := range []string{"std", "pooled"} {
+		t.Setenv("JSON_SERIALIZER", serializer)
+		handler := s.RegisterRoutes()
+
+		for _, tt := range tests {
+			t.Run(serializer+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				resp := httptest.NewRecorder()
+				handler.ServeHTTP(resp, req)
+
+				if resp.Code != http.StatusUnprocessableEntity {
+					t.Fatalf("expected status %d, got %d (%s)", http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+				}
+
+				var got models.APIError
+				if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+					t.Fatalf("error decoding response body: %v", err)
+				}
+				if got.Code != models.ErrorCodeValidationFailed {
+					t.Errorf("expected code %q, got %q", models.ErrorCodeValidationFailed, got.Code)
+				}
+				if _, ok := got.Details[tt.wantField]; !ok {
+					t.Errorf("expected error for field %q, got %v", tt.wantField, got.Details)
+				}
+			})
+		}
+	}
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		wantStatus int
+	}{
+		{"disabled without ADMIN_TOKEN", "", "secret", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "guess", http.StatusUnauthorized},
+		{"valid token", "secret", "secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{adminToken: tt.adminToken}
+			req := httptest.NewRequest(http.MethodGet, "/admin/logging", nil)
+			if tt.header != "" {
+				req.Header.Set(adminTokenHeader, tt.header)
+			}
+			resp := httptest.NewRecorder()
+			s.RegisterRoutes().ServeHTTP(resp, req)
+
+			if resp.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d (%s)", tt.wantStatus, resp.Code, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestStrongSummaryValidatesBeforeWaiting(t *testing.T) {
+	// A queued job the pool never runs keeps it from draining
+	pool := workers.NewPaymentWorkerPool(1, 1, nil, nil)
+	if err := pool.SubmitPayment(models.Payment{ID: uuid.New(), CorrelationID: uuid.New(), Amount: 1000, RequestedAt: time.Now()}); err != nil {
+		t.Fatalf("SubmitPayment() error = %v", err)
+	}
+	s := &Server{db: &stubDB{}, workerPool: pool}
+
+	start := time.Now()
+	status, _ := s.paymentsSummary(context.Background(), url.Values{"consistency": {"strong"}, "from": {"yesterday"}}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", status)
+	}
+	if elapsed := time.Since(start); elapsed >= strongConsistencyWait {
+		t.Errorf("expected the invalid request answered without waiting, took %s", elapsed)
+	}
+}
+
+func TestSummaryErrorDoesNotLeakCause(t *testing.T) {
+	s := &Server{db: &stubDB{summaryErr: errors.New(`relation "payments" does not exist at host db-primary`)}}
+
+	status, body := s.paymentsSummary(context.Background(), url.Values{}, nil)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", status)
+	}
+	if apiErr, ok := body.(*models.APIError); !ok || apiErr.Details != nil {
+		t.Errorf("expected a bare internal error, got %#v", body)
+	}
+}
+
+func TestReloadConfigRejectsSwitchingToWeighted(t *testing.T) {
+	t.Setenv("PROCESSOR_STRATEGY", "failover")
+	t.Setenv("PROCESSOR_WEIGHTS", "default=90,fallback=10")
+	ps := processors.NewProcessorServiceWith(processors.DefaultConfigs("", ""), processors.NewMockProcessor())
+	s := &Server{adminToken: "secret", processors: ps}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/config", strings.NewReader(`{"PROCESSOR_STRATEGY":"weighted"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(adminTokenHeader, "secret")
+	resp := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d (%s)", resp.Code, resp.Body.String())
+	}
+	if name := ps.Strategy().Name(); name != "failover" {
+		t.Errorf("expected the strategy left at failover, got %s", name)
+	}
+	if got := os.Getenv("PROCESSOR_STRATEGY"); got != "failover" {
+		t.Errorf("expected PROCESSOR_STRATEGY left unchanged, got %q", got)
+	}
+}
+
+func TestPaymentRoutesRequireAPIKeyOnceConfigured(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKeys    map[string]string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"no API_KEYS, no key", nil, "", "", http.StatusNotFound},
+		{"missing key", map[string]string{"k1": "acme"}, "", "", http.StatusUnauthorized},
+		{"unknown key", map[string]string{"k1": "acme"}, apiKeyHeader, "k2", http.StatusUnauthorized},
+		{"known key", map[string]string{"k1": "acme"}, apiKeyHeader, "k1", http.StatusNotFound},
+		{"admin token", map[string]string{"k1": "acme"}, adminTokenHeader, "secret", http.StatusNotFound},
+		{"no valid entry", map[string]string{}, "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: &stubDB{}, apiKeys: tt.apiKeys, adminToken: "secret"}
+			req := httptest.NewRequest(http.MethodGet, "/payments/"+uuid.NewString(), nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			resp := httptest.NewRecorder()
+			s.RegisterRoutes().ServeHTTP(resp, req)
+
+			if resp.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d (%s)", tt.wantStatus, resp.Code, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeysSkipsTenantsTooLongForTheColumn(t *testing.T) {
+	t.Setenv("API_KEYS", "k1:acme,k2:"+strings.Repeat("x", maxTenantLength+1))
+
+	keys := loadAPIKeys()
+	if !reflect.DeepEqual(keys, map[string]string{"k1": "acme"}) {
+		t.Errorf("expected only the k1 entry, got %v", keys)
+	}
+}
+
+func TestReloadConfigRejectsInvalidValues(t *testing.T) {
+	s := &Server{adminToken: "secret"}
+	handler := s.RegisterRoutes()
+
+	for _, body := range []string{
+		`{"WORKER_COUNT":"abc"}`,
+		`{"PROCESSOR_RETRY_MAX_ATTEMPTS":"-1"}`,
+		`{"PROCESSOR_STRATEGY":"cheapest"}`,
+		`{"DATABASE_URL":"postgres://elsewhere"}`,
+	} {
+		t.Setenv("WORKER_COUNT", "4")
+		req := httptest.NewRequest(http.MethodPost, "/admin/config", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(adminTokenHeader, "secret")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d (%s)", body, resp.Code, resp.Body.String())
+		}
+		if got := os.Getenv("WORKER_COUNT"); got != "4" {
+			t.Errorf("%s: expected WORKER_COUNT unchanged, got %q", body, got)
+		}
+	}
+}
+
+func TestCancelPaymentHandler(t *testing.T) {
+	pending := &models.Payment{ID: uuid.New(), Status: models.PaymentStatusPending}
+	processing := &models.Payment{ID: uuid.New(), Status: models.PaymentStatusProcessing}
+	s := &Server{db: &stubDB{payments: map[uuid.UUID]*models.Payment{pending.ID: pending, processing.ID: processing}}}
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{"pending", pending.ID.String(), http.StatusOK},
+		{"already cancelled", pending.ID.String(), http.StatusConflict},
+		{"processing", processing.ID.String(), http.StatusConflict},
+		{"not found", uuid.NewString(), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/payments/"+tt.id+"/cancel", nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d (%s)", tt.name, tt.wantStatus, resp.Code, resp.Body.String())
+		}
+	}
+
+	if pending.Status != models.PaymentStatusCancelled {
+		t.Errorf("expected payment to be cancelled, got %s", pending.Status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/payments/"+pending.ID.String()+"/history", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	var history []models.PaymentEvent
+	if err := json.Unmarshal(resp.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode history: %v (%s)", err, resp.Body.String())
+	}
+	if len(history) != 1 || history[0].Status != models.PaymentStatusCancelled || history[0].Actor != apiActor {
+		t.Errorf("expected a single cancelled event by the API, got %+v", history)
+	}
+}
+
+func TestPaymentsSummaryFees(t *testing.T) {
+	s := &Server{db: &stubDB{}}
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		query    string
+		wantFees bool
+	}{
+		{"", false},
+		{"?includeFees=true", true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/payments-summary"+tt.query, nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		body := resp.Body.String()
+		if hasFees := strings.Contains(body, `"totalFee":0.50`) && strings.Contains(body, `"netAmount":9.50`); hasFees != tt.wantFees {
+			t.Errorf("%q: expected fees included = %v, got %s", tt.query, tt.wantFees, body)
+		}
+	}
+}
+
+func TestDuplicatePaymentModes(t *testing.T) {
+	tenant := "acme"
+	existing := &models.Payment{ID: uuid.New(), CorrelationID: uuid.New(), TenantID: &tenant, Status: models.PaymentStatusCompleted}
+	db := &stubDB{payments: map[uuid.UUID]*models.Payment{existing.ID: existing}}
+
+	replay := &Server{db: db, duplicateMode: duplicateReplay}
+	if status, body := replay.duplicatePayment(context.Background(), existing.CorrelationID, &tenant); status != http.StatusOK || body != existing {
+		t.Errorf("replay: expected 200 with the existing payment, got %d %v", status, body)
+	}
+
+	conflict := &Server{db: db, duplicateMode: duplicateConflict}
+	status, body := conflict.duplicatePayment(context.Background(), existing.CorrelationID, &tenant)
+	if apiErr, _ := body.(*models.APIError); status != http.StatusConflict || apiErr == nil || apiErr.Details["paymentId"] != existing.ID.String() {
+		t.Errorf("conflict: expected 409 with the existing payment ID, got %d %v", status, body)
+	}
+
+	other := "globex"
+	status, body = replay.duplicatePayment(context.Background(), existing.CorrelationID, &other)
+	if apiErr, _ := body.(*models.APIError); status != http.StatusConflict || apiErr == nil || apiErr.Details != nil {
+		t.Errorf("other tenant: expected a bare 409, got %d %v", status, body)
+	}
+}
+
+func TestErrorResponsesCarryCodes(t *testing.T) {
+	s := &Server{db: &stubDB{}}
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantCode     string
+	}{
+		{http.MethodGet, "/no-such-route", http.StatusNotFound, models.ErrorCodeNotFound},
+		{http.MethodGet, "/payments/not-a-uuid", http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+		{http.MethodGet, "/payments/" + uuid.NewString(), http.StatusNotFound, models.ErrorCodeNotFound},
+		{http.MethodGet, "/admin/queues", http.StatusForbidden, models.ErrorCodeForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		var got models.APIError
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s %s: error decoding response body: %v", tt.method, tt.path, err)
+		}
+		if resp.Code != tt.wantStatus || got.Code != tt.wantCode || got.Message == "" {
+			t.Errorf("%s %s: expected %d %q, got %d %+v", tt.method, tt.path, tt.wantStatus, tt.wantCode, resp.Code, got)
+		}
+	}
+}
+
+func TestMiddlewareProfiles(t *testing.T) {
+	for _, tt := range []struct {
+		profile   string
+		wantExtra bool
+	}{
+		{"dev", true},
+		{"perf", false},
+	} {
+		t.Setenv("MIDDLEWARE_PROFILE", tt.profile)
+		handler := (&Server{}).RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderOrigin, "http://example.com")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		hasCORS := resp.Header().Get(echo.HeaderAccessControlAllowOrigin) != ""
+		hasRequestID := resp.Header().Get(echo.HeaderXRequestID) != ""
+		if hasCORS != tt.wantExtra || hasRequestID != tt.wantExtra {
+			t.Errorf("%s: expected CORS and request ID = %v, got CORS %v, request ID %v", tt.profile, tt.wantExtra, hasCORS, hasRequestID)
+		}
+	}
+}
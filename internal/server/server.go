@@ -1,23 +1,71 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"rinha-backend-2025/internal/cluster"
+	"rinha-backend-2025/internal/currency"
 	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
 	"rinha-backend-2025/internal/processors"
 	"rinha-backend-2025/internal/workers"
 )
 
+const (
+	warmUpDBConnections  = 10
+	defaultRedriveBatch  = 50
+	defaultSweepInterval = 30 * time.Second
+	defaultStuckAfter    = 2 * time.Minute
+	// retryAfterSeconds is the Retry-After sent when shedding load
+	retryAfterSeconds = 1
+)
+
+// DUPLICATE_PAYMENT_MODE values
+const (
+	duplicateReplay   = "replay"
+	duplicateConflict = "conflict"
+)
+
+// PAYMENT_INSERT_MODE values
+const (
+	insertInRequest = "request"
+	insertInWorker  = "worker"
+)
+
 type Server struct {
 	port        int
 	db          database.Service
+	processors  *processors.ProcessorService
 	workerPool  *workers.PaymentWorkerPool
+	registry    *cluster.Registry
+	converter   *currency.Converter
+	apiKeys     map[string]string
+	adminToken  string
+	deferred    *deferredPayments
+	// maxPaymentAmount caps a single payment; zero means no limit
+	maxPaymentAmount models.Money
+	// queueDepthLimit is the backlog above which new payments get 429; zero
+	// means the full queue capacity
+	queueDepthLimit int
+	// duplicateMode is how a resubmitted correlationId is answered
+	duplicateMode string
+	// insertMode is where new payments are written to the database
+	insertMode string
+	// debugServer serves pprof on DEBUG_ADDR; nil when disabled
+	debugServer *http.Server
+	// summaryCache is nil when SUMMARY_CACHE_TTL is unset
+	summaryCache *summaryCache
+	// reloadMutex serializes POST /admin/config and SIGHUP reloads
+	reloadMutex sync.Mutex
 }
 
 func NewServer() (*http.Server, *Server) {
@@ -35,20 +83,71 @@ func NewServer() (*http.Server, *Server) {
 		fallbackURL = "http://payment-processor-fallback:8080"
 	}
 	
-	processorService := processors.NewProcessorService(defaultURL, fallbackURL)
-	workerPool := workers.NewPaymentWorkerPool(5, 1000, processorService, dbService)
+	processorConfigs, err := processors.ConfigsFromEnv(defaultURL, fallbackURL)
+	if err != nil {
+		slog.Error("falling back to the default and fallback processors", "error", err)
+		processorConfigs = processors.DefaultConfigs(defaultURL, fallbackURL)
+	}
+	processorService := processors.NewProcessorService(processorConfigs)
+	summaryCache := newSummaryCacheFromEnv()
+	workerPool := workers.NewPaymentWorkerPool(loadWorkerCount(), 1000, processorService, dbService)
+	workerPool.OnPaymentWritten(summaryCache.invalidate)
 	workerPool.Start()
 	
+	registry := cluster.NewRegistry(dbService, workerPool.SubmitReclaimed)
+	registryCtx, cancelRegistry := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := registry.Start(registryCtx); err != nil {
+		// Payments stamped with an unregistered ID would never be reclaimed
+		slog.Error("failed to register instance", "instanceId", registry.ID(), "error", err)
+		os.Exit(1)
+	}
+	cancelRegistry()
+	
+	if interval, err := time.ParseDuration(os.Getenv("DLQ_REDRIVE_INTERVAL")); err == nil && interval > 0 {
+		batch, err := strconv.Atoi(os.Getenv("DLQ_REDRIVE_BATCH"))
+		if err != nil || batch <= 0 {
+			batch = defaultRedriveBatch
+		}
+		workerPool.StartRedrive(registry.ID(), interval, batch)
+	}
+	
+	sweepInterval, stuckAfter := loadSweeperConfig()
+	if sweepInterval > 0 {
+		workerPool.StartSweeper(registry.ID(), sweepInterval, stuckAfter)
+	}
+	
 	appServer := &Server{
-		port:       port,
-		db:         dbService,
-		workerPool: workerPool,
+		port:             port,
+		db:               dbService,
+		processors:       processorService,
+		workerPool:       workerPool,
+		registry:         registry,
+		converter:        newCurrencyConverter(),
+		apiKeys:          loadAPIKeys(),
+		adminToken:       os.Getenv("ADMIN_TOKEN"),
+		deferred:         newDeferredPayments(dbService, workerPool, summaryCache),
+		maxPaymentAmount: loadMaxPaymentAmount(),
+		queueDepthLimit:  loadQueueDepthLimit(),
+		duplicateMode:    loadDuplicatePaymentMode(),
+		insertMode:       loadPaymentInsertMode(),
+		debugServer:      startDebugServer(),
+		summaryCache:     summaryCache,
+	}
+
+	if appServer.deferred != nil {
+		appServer.deferred.start()
+	}
+
+	handler := appServer.RegisterRoutes()
+	if os.Getenv("HTTP_MODE") == "raw" {
+		handler = appServer.newRawHandler(handler)
+		slog.Info("serving payment hot path without echo")
 	}
 
 	// Declare Server config
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", appServer.port),
-		Handler:      appServer.RegisterRoutes(),
+		Handler:      handler,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -57,8 +156,107 @@ func NewServer() (*http.Server, *Server) {
 	return httpServer, appServer
 }
 
+func newCurrencyConverter() *currency.Converter {
+	base := os.Getenv("BASE_CURRENCY")
+	if base == "" {
+		base = "BRL"
+	}
+
+	rates, err := currency.ParseRates(os.Getenv("EXCHANGE_RATES"))
+	if err != nil {
+		slog.Warn("ignoring EXCHANGE_RATES", "error", err)
+		rates = nil
+	}
+
+	static := currency.NewStaticRateProvider(rates)
+	return currency.NewConverter(base, currency.NewCachingRateProvider(static, time.Minute), static)
+}
+
+// loadQueueDepthLimit parses PAYMENT_MAX_QUEUE_DEPTH.
+func loadQueueDepthLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("PAYMENT_MAX_QUEUE_DEPTH"))
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// loadDuplicatePaymentMode parses DUPLICATE_PAYMENT_MODE.
+func loadDuplicatePaymentMode() string {
+	switch mode := os.Getenv("DUPLICATE_PAYMENT_MODE"); mode {
+	case "", duplicateReplay:
+		return duplicateReplay
+	case duplicateConflict:
+		return duplicateConflict
+	default:
+		slog.Warn("ignoring DUPLICATE_PAYMENT_MODE", "value", mode)
+		return duplicateReplay
+	}
+}
+
+// loadPaymentInsertMode parses PAYMENT_INSERT_MODE.
+func loadPaymentInsertMode() string {
+	switch mode := os.Getenv("PAYMENT_INSERT_MODE"); mode {
+	case "", insertInRequest:
+		return insertInRequest
+	case insertInWorker:
+		return insertInWorker
+	default:
+		slog.Warn("ignoring PAYMENT_INSERT_MODE", "value", mode)
+		return insertInRequest
+	}
+}
+
+// loadSweeperConfig parses STUCK_SWEEP_INTERVAL and STUCK_PAYMENT_AGE. An
+// interval of 0 disables the sweeper.
+func loadSweeperConfig() (interval, stuckAfter time.Duration) {
+	interval, stuckAfter = defaultSweepInterval, defaultStuckAfter
+	if v, err := time.ParseDuration(os.Getenv("STUCK_SWEEP_INTERVAL")); err == nil && v >= 0 {
+		interval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("STUCK_PAYMENT_AGE")); err == nil && v > 0 {
+		stuckAfter = v
+	}
+	return interval, stuckAfter
+}
+
+func (s *Server) maxQueueDepth() int {
+	capacity := s.workerPool.QueueCapacity()
+	if s.queueDepthLimit > 0 && s.queueDepthLimit < capacity {
+		return s.queueDepthLimit
+	}
+	return capacity
+}
+
+// WarmUp pre-establishes database and processor connections and seeds the
+// processor health cache. It is meant to run before the listener starts so the
+// first requests of a load test don't absorb the setup cost.
+func (s *Server) WarmUp(ctx context.Context) {
+	start := time.Now()
+
+	if err := s.db.WarmUp(ctx, warmUpDBConnections); err != nil {
+		slog.Warn("database warm-up failed", "error", err)
+	}
+
+	s.processors.WarmUp(ctx)
+
+	slog.Info("warm-up finished", "duration", time.Since(start))
+}
+
 func (s *Server) Shutdown() {
+	stopDebugServer(s.debugServer)
+	if s.deferred != nil {
+		s.deferred.stop()
+	}
 	if s.workerPool != nil {
 		s.workerPool.Stop()
 	}
+	if s.registry != nil {
+		s.registry.Stop()
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}
 }
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/metrics"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/processors"
+	"rinha-backend-2025/internal/workers"
+)
+
+// processorStatsWindow is how far back the per-processor fee and latency
+// aggregates in /admin/stats look.
+const processorStatsWindow = 15 * time.Minute
+
+// liveStats is the in-process performance view served by /admin/stats, plus
+// the fees and latencies recorded on the payments completed recently.
+type liveStats struct {
+	Throughput       []workers.MinuteThroughput                           `json:"throughput"`
+	ProcessorLatency map[processors.ProcessorType]metrics.LatencySnapshot `json:"processorLatency"`
+	QueueWait        metrics.LatencySnapshot                              `json:"queueWait"`
+	EndToEnd         metrics.LatencySnapshot                              `json:"endToEnd"`
+	Processors       map[string]models.ProcessorStats                     `json:"processors,omitempty"`
+}
+
+func (s *Server) liveStatsHandler(c echo.Context) error {
+	stats := liveStats{
+		Throughput:       s.workerPool.Throughput(),
+		ProcessorLatency: s.processors.CallLatency(),
+		QueueWait:        s.workerPool.QueueWait(),
+		EndToEnd:         s.workerPool.SLASnapshot(),
+	}
+
+	processorStats, err := s.db.GetProcessorStats(c.Request().Context(), time.Now().Add(-processorStatsWindow))
+	if err != nil {
+		// The in-memory figures are still worth returning
+		slog.Error("failed to get processor stats", "error", err)
+	}
+	stats.Processors = processorStats
+
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"rinha-backend-2025/internal/models"
+)
+
+// summaryKey identifies a /payments-summary query.
+type summaryKey struct {
+	from, to string
+	tenant   string
+}
+
+type cachedSummary struct {
+	summary models.PaymentSummaryResponse
+	at      time.Time
+}
+
+// maxSummaryEntries caps the distinct from/to/tenant queries cached at once.
+const maxSummaryEntries = 1024
+
+// summaryCache keeps recent summaries for ttl. Payments inserted by this
+// instance's handlers, workers and degraded-mode buffer, completions and
+// DELETE /admin/payments clear it, so totals older than ttl are only served
+// for writes made by other instances.
+type summaryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[summaryKey]cachedSummary
+	// generation is bumped by invalidate, so a summary read from the
+	// database before an invalidation is never stored after it
+	generation uint64
+}
+
+// newSummaryCacheFromEnv reads SUMMARY_CACHE_TTL, e.g. "200ms". It returns
+// nil, bypassing the cache, when unset or zero.
+func newSummaryCacheFromEnv() *summaryCache {
+	raw := os.Getenv("SUMMARY_CACHE_TTL")
+	if raw == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl < 0 {
+		slog.Warn("ignoring SUMMARY_CACHE_TTL", "value", raw, "error", err)
+		return nil
+	}
+	if ttl == 0 {
+		return nil
+	}
+	return &summaryCache{ttl: ttl, entries: make(map[summaryKey]cachedSummary)}
+}
+
+// get returns the cached summary for key, if fresh, and the generation to
+// pass to put otherwise. The summary must not be modified.
+func (c *summaryCache) get(key summaryKey) (models.PaymentSummaryResponse, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.at) > c.ttl {
+		return nil, c.generation, false
+	}
+	return entry.summary, c.generation, true
+}
+
+// put stores a summary read at generation, unless it was invalidated since.
+func (c *summaryCache) put(key summaryKey, generation uint64, summary models.PaymentSummaryResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxSummaryEntries {
+		c.prune()
+	}
+	c.entries[key] = cachedSummary{summary: summary, at: time.Now()}
+}
+
+// prune drops expired entries, or every entry if none has expired.
+func (c *summaryCache) prune() {
+	for key, entry := range c.entries {
+		if time.Since(entry.at) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= maxSummaryEntries {
+		clear(c.entries)
+	}
+}
+
+func (c *summaryCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.generation++
+	clear(c.entries)
+	c.mu.Unlock()
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	apiKeyHeader     = "X-API-Key"
+	tenantContextKey = "tenantID"
+	// maxTenantLength matches payments.tenant_id VARCHAR(64)
+	maxTenantLength = 64
+)
+
+// loadAPIKeys parses API_KEYS ("key1:tenantA,key2:tenantB") into a lookup of
+// API key to tenant identifier. It returns nil when API_KEYS is unset, and an
+// empty map when it is set without a usable entry, so keys stay required.
+func loadAPIKeys() map[string]string {
+	raw := strings.TrimSpace(os.Getenv("API_KEYS"))
+	if raw == "" {
+		return nil
+	}
+
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, tenant, ok := strings.Cut(pair, ":")
+		if !ok || key == "" || tenant == "" {
+			slog.Warn("ignoring malformed API_KEYS entry", "entry", pair)
+			continue
+		}
+		if utf8.RuneCountInString(tenant) > maxTenantLength {
+			slog.Warn("ignoring API_KEYS entry with a tenant longer than 64 characters", "tenant", tenant)
+			continue
+		}
+		keys[key] = tenant
+	}
+	if len(keys) == 0 {
+		slog.Warn("API_KEYS has no valid entry, only the admin token can call the payment API")
+	}
+	return keys
+}
+
+// tenantMiddleware resolves the tenant from the X-API-Key header. Requests
+// with an unknown key, or without one once API_KEYS is set, are rejected.
+func (s *Server) tenantMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tenant, ok := s.resolveTenant(c.Request().Header)
+		if !ok {
+			return apiError(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Missing or invalid API key")
+		}
+
+		if tenant != nil {
+			c.Set(tenantContextKey, *tenant)
+		}
+		return next(c)
+	}
+}
+
+// resolveTenant maps the request's API key to its tenant. Without API_KEYS
+// every request is unscoped; with it, a request without a key is only let
+// through, unscoped, with the admin token. ok is false when the request is
+// refused.
+func (s *Server) resolveTenant(header http.Header) (tenant *string, ok bool) {
+	key := header.Get(apiKeyHeader)
+	if key == "" {
+		return nil, s.apiKeys == nil || s.validAdminToken(header.Get(adminTokenHeader))
+	}
+
+	t, ok := s.apiKeys[key]
+	if !ok {
+		return nil, false
+	}
+	return &t, true
+}
+
+// tenantFromContext returns the tenant resolved by tenantMiddleware, if any.
+func tenantFromContext(c echo.Context) *string {
+	tenant, ok := c.Get(tenantContextKey).(string)
+	if !ok {
+		return nil
+	}
+	return &tenant
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// loadMaxPaymentAmount parses PAYMENT_MAX_AMOUNT; zero means no limit.
+func loadMaxPaymentAmount() models.Money {
+	raw := os.Getenv("PAYMENT_MAX_AMOUNT")
+	if raw == "" {
+		return 0
+	}
+
+	max, err := models.ParseMoney(raw)
+	if err != nil || max < 0 {
+		slog.Warn("ignoring PAYMENT_MAX_AMOUNT", "value", raw, "error", err)
+		return 0
+	}
+	return max
+}
+
+// validatePaymentRequest returns the invalid fields of req, keyed by their
+// JSON name, or nil when it is valid. The amount limit is checked by
+// exceedsMaxAmount once the amount is converted.
+func (s *Server) validatePaymentRequest(req models.PaymentRequest) map[string]string {
+	fields := make(map[string]string)
+
+	if req.CorrelationID == uuid.Nil {
+		fields["correlationId"] = "must be a non-nil UUID"
+	}
+
+	if req.Amount <= 0 {
+		fields["amount"] = "must be greater than 0"
+	}
+
+	if req.CallbackURL != "" {
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fields["callbackUrl"] = "must be an absolute http or https URL"
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// exceedsMaxAmount returns the problem with amount, already converted to the
+// base currency, when it is above PAYMENT_MAX_AMOUNT.
+func (s *Server) exceedsMaxAmount(amount models.Money) map[string]string {
+	if s.maxPaymentAmount == 0 || amount <= s.maxPaymentAmount {
+		return nil
+	}
+	return map[string]string{"amount": "must not exceed " + s.maxPaymentAmount.String() + " " + s.converter.Base()}
+}
+
+// validationFailed answers 422, naming every invalid field in the details.
+func validationFailed(fields map[string]string) (int, *models.APIError) {
+	return http.StatusUnprocessableEntity, apiError(http.StatusUnprocessableEntity, models.ErrorCodeValidationFailed, "Validation failed").WithDetails(fields)
+}
+
+// bindErrorResponse turns a sub-cent amount into a validation error; any other
+// decoding error is a malformed request.
+func bindErrorResponse(err error) (int, any) {
+	if errors.Is(err, models.ErrMoneyPrecision) {
+		return validationFailed(map[string]string{"amount": "must have at most 2 decimal places"})
+	}
+	return errorResult(http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Invalid request format")
+}
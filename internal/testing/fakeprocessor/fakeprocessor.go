@@ -0,0 +1,186 @@
+// Package fakeprocessor serves the payment processor API from an httptest
+// server, for tests that exercise the real HTTP client end to end.
+package fakeprocessor
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// Options shape how the fake behaves. The zero value accepts every payment
+// immediately and answers every health check.
+type Options struct {
+	// FailureRate is the fraction of payments answered with a 500, 0 to 1
+	FailureRate float64
+	// Latency delays every response
+	Latency time.Duration
+	// RateLimit is the number of payments accepted per second before
+	// answering 429; zero means no limit
+	RateLimit int
+	// HealthInterval is the minimum time between health checks; earlier ones
+	// get a 429, like the contest processors that allow one per 5s
+	HealthInterval time.Duration
+}
+
+// Payment is a payment the fake accepted.
+type Payment struct {
+	CorrelationID uuid.UUID    `json:"correlationId"`
+	Amount        models.Money `json:"amount"`
+	RequestedAt   string       `json:"requestedAt"`
+}
+
+// Server is a running fake processor. Close it when done.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	opts        Options
+	failing     bool
+	payments    map[uuid.UUID]Payment
+	lastHealth  time.Time
+	windowStart time.Time
+	windowCount int
+}
+
+// New starts a fake processor with the given options.
+func New(opts Options) *Server {
+	s := &Server{opts: opts, payments: make(map[uuid.UUID]Payment)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments", s.processPayment)
+	mux.HandleFunc("GET /payments/service-health", s.health)
+	mux.HandleFunc("GET /payments/{id}", s.getPayment)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetFailing makes the fake fail every payment and report failing health,
+// or go back to its options.
+func (s *Server) SetFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+// Payments returns the payments accepted so far.
+func (s *Server) Payments() []Payment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payments := make([]Payment, 0, len(s.payments))
+	for _, p := range s.payments {
+		payments = append(payments, p)
+	}
+	return payments
+}
+
+// Summary returns the count and total amount of the accepted payments, to be
+// compared with what the API reports in /payments-summary.
+func (s *Server) Summary() (requests int, amount models.Money) {
+	for _, p := range s.Payments() {
+		requests++
+		amount += p.Amount
+	}
+	return requests, amount
+}
+
+func (s *Server) processPayment(w http.ResponseWriter, r *http.Request) {
+	var payment Payment
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil || payment.CorrelationID == uuid.Nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	status := s.admit(time.Now())
+	if status == http.StatusOK {
+		if _, ok := s.payments[payment.CorrelationID]; ok {
+			status = http.StatusUnprocessableEntity
+		} else {
+			s.payments[payment.CorrelationID] = payment
+		}
+	}
+	latency := s.opts.Latency
+	s.mu.Unlock()
+
+	s.delay(r, latency)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, map[string]string{"message": "payment processed successfully"})
+}
+
+// admit decides the status of a payment arriving at now.
+func (s *Server) admit(now time.Time) int {
+	if s.opts.RateLimit > 0 {
+		if now.Sub(s.windowStart) >= time.Second {
+			s.windowStart, s.windowCount = now, 0
+		}
+		if s.windowCount >= s.opts.RateLimit {
+			return http.StatusTooManyRequests
+		}
+		s.windowCount++
+	}
+	if s.failing || rand.Float64() < s.opts.FailureRate {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	now := time.Now()
+	limited := s.opts.HealthInterval > 0 && now.Sub(s.lastHealth) < s.opts.HealthInterval
+	if !limited {
+		s.lastHealth = now
+	}
+	failing, latency := s.failing, s.opts.Latency
+	s.mu.Unlock()
+
+	if limited {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	writeJSON(w, map[string]any{"failing": failing, "minResponseTime": latency.Milliseconds()})
+}
+
+func (s *Server) getPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(strings.TrimSpace(r.PathValue("id")))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	payment, ok := s.payments[id]
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, payment)
+}
+
+func (s *Server) delay(r *http.Request, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	select {
+	case <-time.After(latency):
+	case <-r.Context().Done():
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,306 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed with
+	// WEBHOOK_SECRET, when a secret is configured.
+	SignatureHeader = "X-Webhook-Signature"
+
+	EventPaymentCompleted = "payment.completed"
+	EventPaymentFailed    = "payment.failed"
+
+	queueSize       = 1000
+	hostQueueSize   = 100
+	maxHosts        = 64
+	hostIdleTimeout = 30 * time.Second
+	maxAttempts     = 5
+	baseRetryDelay  = time.Second
+	deliveryTimeout = 5 * time.Second
+)
+
+// Event is the JSON body POSTed to the callback URL.
+type Event struct {
+	Type          string               `json:"type"`
+	PaymentID     uuid.UUID            `json:"paymentId"`
+	CorrelationID uuid.UUID            `json:"correlationId"`
+	Amount        models.Money         `json:"amount"`
+	Status        models.PaymentStatus `json:"status"`
+	Fee           *models.Money        `json:"fee,omitempty"`
+	Processor     string               `json:"processor,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	OccurredAt    time.Time            `json:"occurredAt"`
+}
+
+type delivery struct {
+	url      string
+	event    Event
+	attempts int
+}
+
+// errBlockedAddress is returned for callbacks that resolve to a loopback,
+// private or link-local address of a host that isn't trusted.
+var errBlockedAddress = errors.New("webhook address not allowed")
+
+// Notifier delivers payment events to webhooks in the background, retrying
+// failed deliveries with exponential backoff. Each host gets its own queue
+// and delivery goroutine, so a slow callback only delays its own events.
+// Events are best effort: they are dropped when a queue is full, too many
+// hosts are busy or every attempt fails.
+type Notifier struct {
+	defaultURL string
+	secret     []byte
+	// client is used for trusted hosts, publicClient for every other
+	// callback; it refuses to connect to internal addresses
+	client       *http.Client
+	publicClient *http.Client
+	trusted      map[string]bool
+	queue        chan delivery
+
+	hostsMutex sync.Mutex
+	hosts      map[string]chan delivery
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewNotifierFromEnv uses WEBHOOK_URL as the callback for payments that did
+// not set their own, WEBHOOK_SECRET to sign the bodies and
+// WEBHOOK_ALLOWED_HOSTS as the hosts trusted besides WEBHOOK_URL's.
+func NewNotifierFromEnv() *Notifier {
+	return NewNotifier(os.Getenv("WEBHOOK_URL"), os.Getenv("WEBHOOK_SECRET"), strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",")...)
+}
+
+// NewNotifier delivers to callbacks on the internet only, except on the
+// default URL's host and allowedHosts, which may be internal.
+func NewNotifier(defaultURL, secret string, allowedHosts ...string) *Notifier {
+	trusted := make(map[string]bool)
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			trusted[host] = true
+		}
+	}
+	if u, err := url.Parse(defaultURL); err == nil && u.Hostname() != "" {
+		trusted[strings.ToLower(u.Hostname())] = true
+	}
+
+	dialer := &net.Dialer{Timeout: deliveryTimeout, Control: refuseInternal}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		defaultURL: defaultURL,
+		secret:     []byte(secret),
+		client:     &http.Client{Timeout: deliveryTimeout},
+		publicClient: &http.Client{
+			Timeout:   deliveryTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: deliveryTimeout},
+		},
+		trusted: trusted,
+		queue:   make(chan delivery, queueSize),
+		hosts:   make(map[string]chan delivery),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// refuseInternal is the dialer's Control hook, so it checks the address
+// actually connected to, after DNS resolution.
+func refuseInternal(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	return nil
+}
+
+func (n *Notifier) Start() {
+	n.wg.Add(1)
+	go n.run()
+}
+
+// Stop abandons queued and pending retries.
+func (n *Notifier) Stop() {
+	// Under hostsMutex so run never starts a host goroutine after Wait
+	n.hostsMutex.Lock()
+	n.cancel()
+	n.hostsMutex.Unlock()
+	n.wg.Wait()
+}
+
+// Notify queues event for callbackURL, or for the default URL when the
+// payment has none. It never blocks.
+func (n *Notifier) Notify(callbackURL *string, event Event) {
+	url := n.defaultURL
+	if callbackURL != nil && *callbackURL != "" {
+		url = *callbackURL
+	}
+	if url == "" {
+		return
+	}
+	n.enqueue(delivery{url: url, event: event})
+}
+
+func (n *Notifier) enqueue(d delivery) {
+	if n.ctx.Err() != nil {
+		return
+	}
+	select {
+	case n.queue <- d:
+	default:
+		slog.Warn("webhook queue full, dropping event", "event", d.event.Type, "paymentId", d.event.PaymentID, "correlationId", d.event.CorrelationID)
+	}
+}
+
+// run hands each delivery to the queue of its host, never waiting on one.
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case d := <-n.queue:
+			n.dispatch(d)
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Notifier) dispatch(d delivery) {
+	host := d.url
+	if u, err := url.Parse(d.url); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+
+	n.hostsMutex.Lock()
+	defer n.hostsMutex.Unlock()
+	if n.ctx.Err() != nil {
+		return
+	}
+
+	queue, ok := n.hosts[host]
+	if !ok {
+		if len(n.hosts) >= maxHosts {
+			slog.Warn("too many webhook hosts busy, dropping event", "event", d.event.Type, "paymentId", d.event.PaymentID, "correlationId", d.event.CorrelationID)
+			return
+		}
+		queue = make(chan delivery, hostQueueSize)
+		n.hosts[host] = queue
+		n.wg.Add(1)
+		go n.runHost(host, queue)
+	}
+
+	select {
+	case queue <- d:
+	default:
+		slog.Warn("webhook host queue full, dropping event", "host", host, "event", d.event.Type, "paymentId", d.event.PaymentID, "correlationId", d.event.CorrelationID)
+	}
+}
+
+// runHost delivers the events of one host in order and exits once the host
+// has been idle for hostIdleTimeout.
+func (n *Notifier) runHost(host string, queue chan delivery) {
+	defer n.wg.Done()
+
+	idle := time.NewTimer(hostIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case d := <-queue:
+			n.deliver(d)
+			idle.Reset(hostIdleTimeout)
+		case <-idle.C:
+			n.hostsMutex.Lock()
+			if len(queue) == 0 {
+				delete(n.hosts, host)
+				n.hostsMutex.Unlock()
+				return
+			}
+			n.hostsMutex.Unlock()
+			idle.Reset(hostIdleTimeout)
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Notifier) deliver(d delivery) {
+	d.attempts++
+	err := n.post(d)
+	if err == nil {
+		return
+	}
+
+	if d.attempts >= maxAttempts || errors.Is(err, errBlockedAddress) {
+		slog.Error("giving up on webhook delivery", "event", d.event.Type, "paymentId", d.event.PaymentID, "correlationId", d.event.CorrelationID, "attempts", d.attempts, "error", err)
+		return
+	}
+
+	delay := baseRetryDelay << (d.attempts - 1)
+	slog.Warn("webhook delivery failed, retrying", "event", d.event.Type, "paymentId", d.event.PaymentID, "correlationId", d.event.CorrelationID, "attempt", d.attempts, "retryIn", delay, "error", err)
+	time.AfterFunc(delay, func() { n.enqueue(d) })
+}
+
+func (n *Notifier) post(d delivery) error {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+
+	client := n.publicClient
+	if n.trusted[strings.ToLower(req.URL.Hostname())] {
+		client = n.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,94 @@
+package webhooks
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNotifierSignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if got, want := r.Header.Get(SignatureHeader), Sign([]byte("secret"), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		received <- string(body)
+	}))
+	defer srv.Close()
+
+	n := NewNotifier("", "secret", "127.0.0.1")
+	n.Start()
+	defer n.Stop()
+
+	url := srv.URL
+	n.Notify(&url, Event{Type: EventPaymentCompleted, PaymentID: uuid.New()})
+
+	select {
+	case <-received:
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook was not redelivered")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 delivery attempts, got %d", calls.Load())
+	}
+}
+
+func TestNotifierSlowHostDoesNotDelayOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	received := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer fast.Close()
+
+	n := NewNotifier("", "", "127.0.0.1")
+	n.Start()
+	defer n.Stop()
+
+	slowURL, fastURL := slow.URL, fast.URL
+	for i := 0; i < 3; i++ {
+		n.Notify(&slowURL, Event{Type: EventPaymentCompleted, PaymentID: uuid.New()})
+	}
+	n.Notify(&fastURL, Event{Type: EventPaymentCompleted, PaymentID: uuid.New()})
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("event for the fast host waited on the slow one")
+	}
+}
+
+func TestRefuseInternalAddresses(t *testing.T) {
+	for address, blocked := range map[string]bool{
+		"127.0.0.1:80":       true,
+		"[::1]:80":           true,
+		"10.0.0.5:8080":      true,
+		"192.168.1.1:443":    true,
+		"169.254.169.254:80": true,
+		"0.0.0.0:80":         true,
+		"93.184.216.34:443":  false,
+	} {
+		err := refuseInternal("tcp", address, nil)
+		if got := errors.Is(err, errBlockedAddress); got != blocked {
+			t.Errorf("%s: blocked = %v, want %v (%v)", address, got, blocked, err)
+		}
+	}
+}
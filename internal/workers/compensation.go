@@ -0,0 +1,166 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+	"rinha-backend-2025/internal/processors"
+)
+
+const (
+	completionImmediateRetries = 3
+	completionRetryDelay       = 50 * time.Millisecond
+	compensationInterval       = time.Second
+	compensationVerifyAfter    = 5
+)
+
+// pendingCompletion is a payment the processor already accepted but that we
+// could not record locally. It must never be submitted to a processor again.
+type pendingCompletion struct {
+	job           PaymentJob
+	fee           models.Money
+	processorType processors.ProcessorType
+	latency       time.Duration
+	attempts      int
+	verified      bool
+}
+
+// compensator keeps retrying local completion writes for payments that were
+// charged by a processor, reconciling against the processor when the writes
+// keep failing.
+//
+// pending only lives in memory: there is nowhere durable to note the charge
+// while the database refuses writes. A payment the instance dies holding stays
+// processing under its owner, and whoever reclaims it (a peer's registry, or
+// this instance restarting with the same INSTANCE_ID) submits it with
+// VerifyFirst, which finds the charge on the processor and records it without
+// sending the payment again.
+type compensator struct {
+	pool    *PaymentWorkerPool
+	mu      sync.Mutex
+	pending map[uuid.UUID]*pendingCompletion
+}
+
+func newCompensator(pool *PaymentWorkerPool) *compensator {
+	return &compensator{
+		pool:    pool,
+		pending: make(map[uuid.UUID]*pendingCompletion),
+	}
+}
+
+func (c *compensator) add(job PaymentJob, fee models.Money, processorType processors.ProcessorType, latency time.Duration) {
+	c.mu.Lock()
+	c.pending[job.PaymentID] = &pendingCompletion{
+		job:           job,
+		fee:           fee,
+		processorType: processorType,
+		latency:       latency,
+	}
+	c.mu.Unlock()
+
+	slog.Warn("payment charged but not recorded, queued for compensation", "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "processor", processorType)
+}
+
+func (c *compensator) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+func (c *compensator) has(paymentID uuid.UUID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.pending[paymentID]
+	return ok
+}
+
+func (c *compensator) run(ctx context.Context) {
+	defer c.pool.wg.Done()
+
+	ticker := time.NewTicker(compensationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.retryPending(ctx)
+		case <-ctx.Done():
+			if n := c.size(); n > 0 {
+				slog.Warn("compensator stopped with payments awaiting local completion, leaving them processing for reclaim", "pending", n)
+			}
+			return
+		}
+	}
+}
+
+func (c *compensator) retryPending(ctx context.Context) {
+	c.mu.Lock()
+	batch := make([]*pendingCompletion, 0, len(c.pending))
+	for _, p := range c.pending {
+		batch = append(batch, p)
+	}
+	c.mu.Unlock()
+
+	for _, p := range batch {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.reconcile(ctx, p) {
+			c.mu.Lock()
+			delete(c.pending, p.job.PaymentID)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// reconcile reports whether the pending completion is resolved.
+func (c *compensator) reconcile(ctx context.Context, p *pendingCompletion) bool {
+	err := c.pool.dbService.CompletePayment(ctx, p.job.PaymentID, p.fee, string(p.processorType), p.latency)
+	if errors.Is(err, database.ErrPaymentAlreadyCompleted) {
+		slog.Warn("payment was already completed, keeping the first completion", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "processor", p.processorType)
+		return true
+	}
+	if err == nil {
+		slog.Info("compensated payment, completion recorded", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "retries", p.attempts+1)
+		c.pool.written()
+		c.pool.processed.Add(1)
+		c.pool.recordEvent(ctx, p.job.PaymentID, models.PaymentStatusCompleted, compensatorActor, string(p.processorType), "")
+		c.pool.notifyCompleted(p.job, p.fee, p.processorType)
+		return true
+	}
+
+	p.attempts++
+	if p.verified || p.attempts < compensationVerifyAfter {
+		return false
+	}
+
+	found, verifyErr := c.pool.processorService.VerifyPayment(ctx, p.job.CorrelationID, p.processorType)
+	if verifyErr != nil {
+		slog.Error("failed to verify payment with processor", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "processor", p.processorType, "error", verifyErr)
+		return false
+	}
+
+	if found {
+		// The money moved, so the only acceptable outcome is recording it.
+		p.verified = true
+		slog.Warn("payment confirmed by processor, retrying local completion", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "processor", p.processorType)
+		return false
+	}
+
+	slog.Warn("payment unknown to processor, marking as failed", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "processor", p.processorType)
+	if err := c.pool.dbService.FailPayment(ctx, p.job.PaymentID, models.FailureReasonTransient); err != nil {
+		slog.Error("failed to mark payment as failed", "paymentId", p.job.PaymentID, "correlationId", p.job.CorrelationID, "error", err)
+		return false
+	}
+	reason := "local completion kept failing and " + string(p.processorType) + " processor has no record of the payment"
+	c.pool.failed.Add(1)
+	c.pool.recordEvent(ctx, p.job.PaymentID, models.PaymentStatusFailed, compensatorActor, "", reason)
+	c.pool.alertFailed(p.job, reason)
+	return true
+}
@@ -0,0 +1,84 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+// RequeueFailed moves failed payments back to pending under owner and queues
+// them again, taking at most as many as currently fit in the queue. A nil
+// paymentID re-drives the least re-driven failures first, skipping rejected
+// and expired ones and those already re-driven maxRedrives times.
+func (wp *PaymentWorkerPool) RequeueFailed(ctx context.Context, owner string, paymentID *uuid.UUID, limit int) (int, error) {
+	if free := cap(wp.retryQueue) - len(wp.retryQueue); limit <= 0 || limit > free {
+		limit = free
+	}
+	if limit == 0 {
+		return 0, nil
+	}
+
+	payments, err := wp.dbService.RequeueFailedPayments(ctx, paymentID, owner, limit, wp.maxRedrives)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, payment := range payments {
+		if err := wp.submitRequeued(ctx, payment); err != nil {
+			// The rest stay pending under owner; if this instance goes away
+			// a peer reclaims them.
+			return i, err
+		}
+	}
+
+	return len(payments), nil
+}
+
+// submitRequeued queues a previously failed payment. A failure may have been
+// a timeout after the processor accepted it, so the worker verifies first.
+func (wp *PaymentWorkerPool) submitRequeued(ctx context.Context, payment models.Payment) error {
+	job := newJob(payment)
+	job.VerifyFirst = true
+
+	select {
+	case wp.retryQueue <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wp.ctx.Done():
+		return wp.ctx.Err()
+	}
+}
+
+// StartRedrive periodically requeues up to batch failed payments. It runs on
+// a much slower schedule than the workers and stops with the pool.
+func (wp *PaymentWorkerPool) StartRedrive(owner string, interval time.Duration, batch int) {
+	wp.wg.Add(1)
+	go func() {
+		defer wp.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(wp.ctx, 10*time.Second)
+				n, err := wp.RequeueFailed(ctx, owner, nil, batch)
+				cancel()
+				if err != nil {
+					slog.Error("failed to re-drive failed payments", "error", err)
+				} else if n > 0 {
+					slog.Info("re-drove failed payments", "count", n)
+				}
+			case <-wp.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	slog.Info("started failed payment re-drive", "interval", interval, "batch", batch)
+}
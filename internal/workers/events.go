@@ -0,0 +1,32 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/models"
+)
+
+const compensatorActor = "compensator"
+
+func workerActor(workerID int) string {
+	return "worker-" + strconv.Itoa(workerID)
+}
+
+// recordEvent appends a transition to the payment history. The history is
+// for debugging, so a failed write is logged and never fails the payment.
+func (wp *PaymentWorkerPool) recordEvent(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus, actor, processorType, errText string) {
+	event := models.PaymentEvent{PaymentID: paymentID, Status: status, Actor: actor}
+	if processorType != "" {
+		event.ProcessorType = &processorType
+	}
+	if errText != "" {
+		event.Error = &errText
+	}
+
+	if err := wp.dbService.RecordPaymentEvent(ctx, event); err != nil {
+		slog.Warn("failed to record payment event", "paymentId", paymentID, "status", status, "actor", actor, "error", err)
+	}
+}
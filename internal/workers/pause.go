@@ -0,0 +1,107 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// pauseGate lets the admin API stop workers from taking new jobs. The zero
+// value is running.
+type pauseGate struct {
+	mu sync.Mutex
+	// pausing is closed when the gate pauses, waking workers blocked on an
+	// empty queue.
+	pausing chan struct{}
+	// resumed is non-nil while paused and closed on resume.
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pausingCh() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pausing == nil {
+		g.pausing = make(chan struct{})
+	}
+	return g.pausing
+}
+
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	if g.pausing == nil {
+		g.pausing = make(chan struct{})
+	}
+	close(g.pausing)
+	g.resumed = make(chan struct{})
+	return true
+}
+
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	g.pausing = make(chan struct{})
+	return true
+}
+
+// wake interrupts workers blocked on an empty queue without pausing them.
+func (g *pauseGate) wake() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return
+	}
+	if g.pausing != nil {
+		close(g.pausing)
+	}
+	g.pausing = make(chan struct{})
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks while the gate is paused. It returns false if ctx is done.
+func (g *pauseGate) wait(ctx context.Context) bool {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Pause stops workers from taking new jobs once they finish the current one.
+// Payments keep being accepted and queued meanwhile.
+func (wp *PaymentWorkerPool) Pause() {
+	if wp.gate.pause() {
+		slog.Info("payment workers paused")
+	}
+}
+
+func (wp *PaymentWorkerPool) Resume() {
+	if wp.gate.resume() {
+		slog.Info("payment workers resumed")
+	}
+}
+
+func (wp *PaymentWorkerPool) Paused() bool {
+	return wp.gate.paused()
+}
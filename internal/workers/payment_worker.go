@@ -2,28 +2,116 @@ package workers
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"rinha-backend-2025/internal/alerts"
 	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/logging"
+	"rinha-backend-2025/internal/metrics"
 	"rinha-backend-2025/internal/models"
 	"rinha-backend-2025/internal/processors"
+	"rinha-backend-2025/internal/webhooks"
 )
 
 type PaymentJob struct {
 	PaymentID     uuid.UUID
 	CorrelationID uuid.UUID
-	Amount        float64
+	Amount        models.Money
 	RequestedAt   time.Time
+	EnqueuedAt    time.Time
+	TenantID      *string
+	CallbackURL   *string
+	// VerifyFirst is set for reclaimed payments that may already have been
+	// charged, so the worker checks the processors before submitting again.
+	VerifyFirst bool
+	// Unsaved is set for payments submitted by SubmitUnsaved, which the
+	// worker inserts before processing; PaymentID is zero until then.
+	Unsaved *models.Payment
 }
 
+// ErrQueueFull is returned by SubmitPayment when the job queue has no room.
+var ErrQueueFull = errors.New("payment queue is full")
+
+// ErrPoolStopped is returned by SubmitPayment once Stop has begun.
+var ErrPoolStopped = errors.New("payment worker pool is stopping")
+
+func newJob(payment models.Payment) PaymentJob {
+	return PaymentJob{
+		PaymentID:     payment.ID,
+		CorrelationID: payment.CorrelationID,
+		Amount:        payment.Amount,
+		RequestedAt:   payment.RequestedAt,
+		EnqueuedAt:    time.Now(),
+		TenantID:      payment.TenantID,
+		CallbackURL:   payment.CallbackURL,
+	}
+}
+
+const (
+	slaWindow     = time.Minute
+	slaMaxSamples = 10000
+	// throughputMinutes is how many per-minute buckets Throughput keeps.
+	throughputMinutes = 15
+	// retryAging is how long retries may wait behind fresh payments before a
+	// worker takes one ahead of them.
+	retryAging = 500 * time.Millisecond
+	// defaultJobTimeout bounds one payment when JOB_TIMEOUT is unset.
+	defaultJobTimeout = 30 * time.Second
+	// defaultShutdownGrace is how long Stop lets jobs in flight finish.
+	defaultShutdownGrace = 5 * time.Second
+	// defaultMaxRedrives caps batch re-drives of one payment when
+	// DLQ_MAX_REDRIVES is unset.
+	defaultMaxRedrives = 3
+	inFlightPollInterval = 10 * time.Millisecond
+)
+
+// PaymentWorkerPool consumes two queues: jobQueue for fresh payments and
+// retryQueue for payments submitted again (reclaimed or re-driven), so a burst
+// of retries can't push up the latency of new traffic.
 type PaymentWorkerPool struct {
 	jobQueue         chan PaymentJob
-	workers          int
+	retryQueue       chan PaymentJob
 	processorService *processors.ProcessorService
 	dbService        database.Service
+	slaTracker       *metrics.LatencyTracker
+	queueWait        *metrics.LatencyTracker
+	accepted         *metrics.RollingCounter
+	processed        *metrics.RollingCounter
+	failed           *metrics.RollingCounter
+	compensator      *compensator
+	alerts           alerts.Sink
+	notifier         *webhooks.Notifier
+	// onWritten is called after a worker inserts or completes a payment
+	onWritten        func()
+	maxJobAge        time.Duration // 0 disables the age limit
+	pendingMaxAge    time.Duration // 0 disables expiring pending payments
+	jobTimeout       time.Duration
+	shutdownGrace    time.Duration
+	maxRedrives      int
+	// workersMutex guards workerStates, activeWorkers and started; slots
+	// only grow, the ones at or past activeWorkers are retired
+	workersMutex  sync.RWMutex
+	workerStates  []*workerState
+	activeWorkers int
+	started       bool
+	// submitMutex keeps Stop from closing jobQueue while a submit is
+	// sending on it; stopping is set once Stop begins
+	submitMutex sync.RWMutex
+	stopping    bool
+	lastDequeued     atomic.Int64 // EnqueuedAt (unix nanos) of the last job taken off jobQueue
+	lastRetryServed  atomic.Int64 // unix nanos of the last job taken off retryQueue
+	stuckRecovered   atomic.Uint64
+	expired          atomic.Uint64
+	expiredDropped   atomic.Uint64
+	gate             pauseGate
 	wg               sync.WaitGroup
 	ctx              context.Context
 	cancel           context.CancelFunc
@@ -32,107 +120,537 @@ type PaymentWorkerPool struct {
 func NewPaymentWorkerPool(workers int, queueSize int, processorService *processors.ProcessorService, dbService database.Service) *PaymentWorkerPool {
 	ctx, cancel := context.WithCancel(context.Background())
 	
-	return &PaymentWorkerPool{
+	wp := &PaymentWorkerPool{
 		jobQueue:         make(chan PaymentJob, queueSize),
-		workers:          workers,
+		retryQueue:       make(chan PaymentJob, queueSize),
 		processorService: processorService,
 		dbService:        dbService,
+		slaTracker:       metrics.NewLatencyTracker(slaWindow, slaMaxSamples),
+		queueWait:        metrics.NewLatencyTracker(slaWindow, slaMaxSamples),
+		accepted:         metrics.NewRollingCounter(throughputMinutes, time.Minute),
+		processed:        metrics.NewRollingCounter(throughputMinutes, time.Minute),
+		failed:           metrics.NewRollingCounter(throughputMinutes, time.Minute),
+		alerts:           alerts.FromEnv(),
+		notifier:         webhooks.NewNotifierFromEnv(),
+		maxJobAge:        maxJobAgeFromEnv(),
+		pendingMaxAge:    pendingMaxAgeFromEnv(),
+		jobTimeout:       jobTimeoutFromEnv(),
+		shutdownGrace:    shutdownGraceFromEnv(),
+		maxRedrives:      maxRedrivesFromEnv(),
 		ctx:              ctx,
 		cancel:           cancel,
 	}
+	wp.compensator = newCompensator(wp)
+	wp.resize(workers)
+
+	return wp
 }
 
-func (wp *PaymentWorkerPool) Start() {
-	for i := 0; i < wp.workers; i++ {
-		wp.wg.Add(1)
-		go wp.worker(i)
+// maxJobAgeFromEnv reads PAYMENT_MAX_JOB_AGE, the age (from RequestedAt)
+// after which a payment gets no further attempts. Unset disables the limit.
+func maxJobAgeFromEnv() time.Duration {
+	raw := os.Getenv("PAYMENT_MAX_JOB_AGE")
+	if raw == "" {
+		return 0
+	}
+	age, err := time.ParseDuration(raw)
+	if err != nil || age < 0 {
+		slog.Warn("ignoring PAYMENT_MAX_JOB_AGE", "value", raw, "error", err)
+		return 0
+	}
+	return age
+}
+
+// pendingMaxAgeFromEnv reads PENDING_MAX_AGE, the age (from RequestedAt)
+// after which a payment nobody started is failed. Unset disables it.
+func pendingMaxAgeFromEnv() time.Duration {
+	raw := os.Getenv("PENDING_MAX_AGE")
+	if raw == "" {
+		return 0
+	}
+	age, err := time.ParseDuration(raw)
+	if err != nil || age < 0 {
+		slog.Warn("ignoring PENDING_MAX_AGE", "value", raw, "error", err)
+		return 0
+	}
+	return age
+}
+
+// jobTimeoutFromEnv reads JOB_TIMEOUT, the time a worker gives one payment,
+// processor retries and status updates included.
+func jobTimeoutFromEnv() time.Duration {
+	raw := os.Getenv("JOB_TIMEOUT")
+	if raw == "" {
+		return defaultJobTimeout
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		slog.Warn("ignoring JOB_TIMEOUT", "value", raw, "error", err)
+		return defaultJobTimeout
+	}
+	return timeout
+}
+
+// shutdownGraceFromEnv reads SHUTDOWN_GRACE_PERIOD; 0 cancels jobs in
+// flight right away.
+func shutdownGraceFromEnv() time.Duration {
+	raw := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if raw == "" {
+		return defaultShutdownGrace
+	}
+	grace, err := time.ParseDuration(raw)
+	if err != nil || grace < 0 {
+		slog.Warn("ignoring SHUTDOWN_GRACE_PERIOD", "value", raw, "error", err)
+		return defaultShutdownGrace
+	}
+	return grace
+}
+
+// maxRedrivesFromEnv reads DLQ_MAX_REDRIVES, how many times a batch
+// re-drive may move one failed payment back to pending.
+func maxRedrivesFromEnv() int {
+	raw := os.Getenv("DLQ_MAX_REDRIVES")
+	if raw == "" {
+		return defaultMaxRedrives
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		slog.Warn("ignoring DLQ_MAX_REDRIVES", "value", raw, "error", err)
+		return defaultMaxRedrives
 	}
-	log.Printf("Started %d payment workers", wp.workers)
+	return n
 }
 
+func (wp *PaymentWorkerPool) Start() {
+	wp.workersMutex.Lock()
+	wp.started = true
+	wp.startWorkersLocked()
+	wp.workersMutex.Unlock()
+
+	wp.wg.Add(1)
+	go wp.compensator.run(wp.ctx)
+	wp.notifier.Start()
+	slog.Info("started payment workers", "workers", wp.Workers())
+}
+
+// Stop lets the jobs in flight finish, up to the shutdown grace period, and
+// stops the workers. Nothing is lost with the in-memory queue: payments
+// still queued stay pending and the ones cut short stay processing, and the
+// next instance reclaims both (verifying the processing ones against the
+// processors first) once the registry expires this one.
 func (wp *PaymentWorkerPool) Stop() {
+	// A handler still running after the HTTP shutdown timed out gets
+	// ErrPoolStopped instead of sending on the closed queue
+	wp.submitMutex.Lock()
+	wp.stopping = true
+	wp.submitMutex.Unlock()
+
+	wp.gate.pause()
+	interrupted := wp.waitInFlight(wp.shutdownGrace)
+
 	close(wp.jobQueue)
 	wp.cancel()
 	wp.wg.Wait()
-	log.Println("Payment worker pool stopped")
+	wp.notifier.Stop()
+
+	if queued := len(wp.jobQueue) + len(wp.retryQueue); queued > 0 || interrupted > 0 {
+		slog.Warn("left unfinished payments for reclaim", "queued", queued, "interrupted", interrupted)
+	}
+	wp.saveUnsaved()
+	slog.Info("payment worker pool stopped")
 }
 
-func (wp *PaymentWorkerPool) SubmitPayment(paymentID, correlationID uuid.UUID, amount float64, requestedAt time.Time) error {
-	job := PaymentJob{
-		PaymentID:     paymentID,
-		CorrelationID: correlationID,
-		Amount:        amount,
-		RequestedAt:   requestedAt,
+// waitInFlight waits until no worker is busy or timeout passes, returning
+// how many were still busy.
+func (wp *PaymentWorkerPool) waitInFlight(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		busy := 0
+		states, _ := wp.states()
+		for _, state := range states {
+			if state.busySince.Load() > 0 {
+				busy++
+			}
+		}
+		if busy == 0 || !time.Now().Before(deadline) {
+			return busy
+		}
+		time.Sleep(inFlightPollInterval)
+	}
+}
+
+// SubmitPayment queues a newly created payment, returning ErrQueueFull
+// instead of blocking when there is no room.
+func (wp *PaymentWorkerPool) SubmitPayment(payment models.Payment) error {
+	return wp.submit(newJob(payment))
+}
+
+func (wp *PaymentWorkerPool) submit(job PaymentJob) error {
+	wp.submitMutex.RLock()
+	defer wp.submitMutex.RUnlock()
+	if wp.stopping {
+		return ErrPoolStopped
 	}
 
 	select {
 	case wp.jobQueue <- job:
+		wp.accepted.Add(1)
 		return nil
-	case <-wp.ctx.Done():
-		return wp.ctx.Err()
 	default:
-		return nil
+		return ErrQueueFull
 	}
 }
 
+// QueueLength returns the number of fresh payments waiting for a worker.
+func (wp *PaymentWorkerPool) QueueLength() int {
+	return len(wp.jobQueue)
+}
+
+func (wp *PaymentWorkerPool) QueueCapacity() int {
+	return cap(wp.jobQueue)
+}
+
+// Workers returns the number of active workers.
+func (wp *PaymentWorkerPool) Workers() int {
+	wp.workersMutex.RLock()
+	defer wp.workersMutex.RUnlock()
+	return wp.activeWorkers
+}
+
 func (wp *PaymentWorkerPool) worker(workerID int) {
 	defer wp.wg.Done()
 	
-	log.Printf("Payment worker %d started", workerID)
+	slog.Debug("payment worker started", "worker", workerID)
 	
+	state := wp.state(workerID)
 	for {
-		select {
-		case job, ok := <-wp.jobQueue:
-			if !ok {
-				log.Printf("Payment worker %d stopped - job queue closed", workerID)
-				return
+		if wp.retire(workerID) {
+			slog.Debug("payment worker retired", "worker", workerID)
+			return
+		}
+		if !wp.gate.wait(wp.ctx) {
+			slog.Debug("payment worker stopped", "worker", workerID)
+			return
+		}
+		
+		job, ok := wp.nextJob()
+		if !ok {
+			// Woken up by a pause or resize; the checks above decide
+			if wp.ctx.Err() == nil && (wp.gate.paused() || wp.retire(workerID)) {
+				continue
 			}
-			wp.processPayment(job, workerID)
-			
-		case <-wp.ctx.Done():
-			log.Printf("Payment worker %d stopped - context cancelled", workerID)
+			slog.Debug("payment worker stopped", "worker", workerID)
 			return
 		}
+		
+		state.start(job.PaymentID)
+		wp.processPayment(job, workerID)
+		state.finish()
+	}
+}
+
+// nextJob takes fresh payments first. Retries are served when no fresh job is
+// waiting, or ahead of fresh jobs once none has been served for retryAging,
+// so they are never starved. It returns false when the pool is stopping or
+// gets paused while waiting.
+func (wp *PaymentWorkerPool) nextJob() (PaymentJob, bool) {
+	pausing := wp.gate.pausingCh()
+	
+	if len(wp.retryQueue) > 0 && time.Since(time.Unix(0, wp.lastRetryServed.Load())) > retryAging {
+		select {
+		case job := <-wp.retryQueue:
+			return wp.dequeued(job, true), true
+		default:
+		}
+	}
+	
+	select {
+	case job, ok := <-wp.jobQueue:
+		if !ok {
+			return PaymentJob{}, false
+		}
+		return wp.dequeued(job, false), true
+	default:
+	}
+	
+	select {
+	case job, ok := <-wp.jobQueue:
+		if !ok {
+			return PaymentJob{}, false
+		}
+		return wp.dequeued(job, false), true
+	case job := <-wp.retryQueue:
+		return wp.dequeued(job, true), true
+	case <-pausing:
+		return PaymentJob{}, false
+	case <-wp.ctx.Done():
+		return PaymentJob{}, false
 	}
 }
 
+// dequeued records the queue wait of a job just taken off a queue. Only
+// called with real jobs, never the zero value of a closed jobQueue.
+func (wp *PaymentWorkerPool) dequeued(job PaymentJob, retry bool) PaymentJob {
+	wp.queueWait.Observe(time.Since(job.EnqueuedAt))
+	if retry {
+		wp.lastRetryServed.Store(time.Now().UnixNano())
+	} else {
+		wp.lastDequeued.Store(job.EnqueuedAt.UnixNano())
+	}
+	return job
+}
+
 func (wp *PaymentWorkerPool) processPayment(job PaymentJob, workerID int) {
-	log.Printf("Worker %d processing payment %s with RequestedAt: %v", workerID, job.PaymentID, job.RequestedAt)
+	logger := slog.With("worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID)
 	
-	ctx, cancel := context.WithTimeout(wp.ctx, 30*time.Second)
+	logging.HotPath("processing payment", "worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "requestedAt", job.RequestedAt)
+	
+	ctx, cancel := context.WithTimeout(wp.ctx, wp.jobTimeout)
 	defer cancel()
 
-	if err := wp.dbService.UpdatePaymentStatus(ctx, job.PaymentID, models.PaymentStatusProcessing); err != nil {
-		log.Printf("Worker %d failed to update payment %s to processing: %v", workerID, job.PaymentID, err)
+	if job.Unsaved != nil {
+		if !wp.insertUnsaved(ctx, &job, logger) {
+			return
+		}
+		logger = slog.With("worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID)
+	}
+
+	// A reclaimed processing payment may already be charged, so only
+	// fresh ones expire
+	if wp.pendingMaxAge > 0 && !job.VerifyFirst && time.Since(job.RequestedAt) > wp.pendingMaxAge {
+		wp.expirePayment(ctx, job, workerID, logger)
 		return
 	}
 
-	resp, processorType, err := wp.processorService.ProcessPaymentWithFallback(ctx, job.CorrelationID, job.Amount, job.RequestedAt)
+	// Only a pending payment may start, so one the sweeper expired or a
+	// client cancelled meanwhile stays as it is. Reclaimed payments are
+	// already processing.
+	from := []models.PaymentStatus{models.PaymentStatusPending}
+	if job.VerifyFirst {
+		from = append(from, models.PaymentStatusProcessing)
+	}
+	started, err := wp.dbService.TransitionPaymentStatus(ctx, job.PaymentID, models.PaymentStatusProcessing, from...)
 	if err != nil {
-		log.Printf("Worker %d failed to process payment %s: %v", workerID, job.PaymentID, err)
-		
-		if updateErr := wp.dbService.UpdatePaymentStatus(ctx, job.PaymentID, models.PaymentStatusFailed); updateErr != nil {
-			log.Printf("Worker %d failed to update payment %s to failed: %v", workerID, job.PaymentID, updateErr)
+		logger.Error("failed to update payment to processing", "error", err)
+		wp.state(workerID).failed.Add(1)
+		return
+	}
+	if !started {
+		logging.HotPath("payment no longer pending, skipping job", "paymentId", job.PaymentID, "correlationId", job.CorrelationID)
+		return
+	}
+	wp.recordEvent(ctx, job.PaymentID, models.PaymentStatusProcessing, workerActor(workerID), "", "")
+
+	if job.VerifyFirst {
+		if processorType, found := wp.findCharge(ctx, job); found {
+			logger.Info("payment already charged, completing without resubmitting", "processor", processorType)
+			wp.finishPayment(ctx, job, processorType, workerID, 0)
+			return
 		}
+	}
+
+	attemptCtx := ctx
+	if wp.maxJobAge > 0 {
+		deadline := job.RequestedAt.Add(wp.maxJobAge)
+		if time.Now().After(deadline) {
+			logger.Warn("payment exceeded max job age, failing without another attempt", "requestedAt", job.RequestedAt, "maxJobAge", wp.maxJobAge)
+			wp.failPayment(ctx, job, workerID, models.FailureReasonMaxAge, fmt.Errorf("payment older than max job age %s", wp.maxJobAge))
+			return
+		}
+		attemptCtx = processors.WithRetryDeadline(ctx, deadline)
+	}
+
+	callStart := time.Now()
+	resp, processorType, err := wp.processorService.ProcessPaymentWithFallback(attemptCtx, job.CorrelationID, job.Amount, job.RequestedAt)
+	latency := time.Since(callStart)
+	if err != nil {
+		errorClass := processors.ClassifyError(err)
+		logger.Error("failed to process payment", "errorClass", errorClass, "error", err)
+		reason := models.FailureReasonTransient
+		if errorClass == processors.ErrorClassRejected {
+			reason = models.FailureReasonRejected
+		}
+		wp.failPayment(ctx, job, workerID, reason, err)
 		return
 	}
 
-	log.Printf("Worker %d successfully processed payment %s with %s processor, response: %s", workerID, job.PaymentID, processorType, resp.Message)
+	logging.HotPath("processor accepted payment", "worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "processor", processorType, "response", resp.Message)
 
-	// Since the new API doesn't return fee, we'll use default values based on processor type
-	var fee float64
-	if processorType == processors.ProcessorTypeDefault {
-		fee = job.Amount * 0.03 // 3% for default processor
-	} else {
-		fee = job.Amount * 0.05 // 5% for fallback processor
+	wp.finishPayment(ctx, job, processorType, workerID, latency)
+}
+
+// failPayment marks the payment failed, leaving it for the DLQ re-drive
+// unless reason rules another attempt out.
+func (wp *PaymentWorkerPool) failPayment(ctx context.Context, job PaymentJob, workerID int, reason models.FailureReason, cause error) {
+	wp.state(workerID).failed.Add(1)
+	wp.failed.Add(1)
+
+	if err := wp.dbService.FailPayment(ctx, job.PaymentID, reason); err != nil {
+		slog.Error("failed to update payment to failed", "worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "error", err)
+		return
+	}
+	wp.recordEvent(ctx, job.PaymentID, models.PaymentStatusFailed, workerActor(workerID), "", cause.Error())
+	wp.alertFailed(job, cause.Error())
+}
+
+// expirePayment fails a payment that waited in the queue past
+// pendingMaxAge. If the sweeper got to it first nothing is recorded again.
+func (wp *PaymentWorkerPool) expirePayment(ctx context.Context, job PaymentJob, workerID int, logger *slog.Logger) {
+	expired, err := wp.dbService.ExpirePayment(ctx, job.PaymentID)
+	if err != nil {
+		logger.Error("failed to expire payment", "error", err)
+		wp.state(workerID).failed.Add(1)
+		return
+	}
+	if !expired {
+		logger.Info("payment no longer pending, dropping expired job")
+		return
+	}
+
+	logger.Warn("payment expired while pending, failed without an attempt", "requestedAt", job.RequestedAt, "pendingMaxAge", wp.pendingMaxAge)
+	wp.expiredDropped.Add(1)
+	wp.state(workerID).failed.Add(1)
+	wp.failed.Add(1)
+	reason := fmt.Sprintf("payment pending longer than %s", wp.pendingMaxAge)
+	wp.recordEvent(ctx, job.PaymentID, models.PaymentStatusFailed, workerActor(workerID), "", reason)
+	wp.alertFailed(job, reason)
+}
+
+// alertFailed notifies the alert sink and the payment's webhook that the
+// payment was marked failed.
+func (wp *PaymentWorkerPool) alertFailed(job PaymentJob, reason string) {
+	now := time.Now().UTC()
+	wp.alerts.PaymentFailed(alerts.PaymentFailure{
+		PaymentID:     job.PaymentID,
+		CorrelationID: job.CorrelationID,
+		Amount:        job.Amount,
+		TenantID:      job.TenantID,
+		Reason:        reason,
+		FailedAt:      now,
+	})
+	wp.notifier.Notify(job.CallbackURL, webhooks.Event{
+		Type:          webhooks.EventPaymentFailed,
+		PaymentID:     job.PaymentID,
+		CorrelationID: job.CorrelationID,
+		Amount:        job.Amount,
+		Status:        models.PaymentStatusFailed,
+		Error:         reason,
+		OccurredAt:    now,
+	})
+}
+
+func (wp *PaymentWorkerPool) notifyCompleted(job PaymentJob, fee models.Money, processorType processors.ProcessorType) {
+	wp.notifier.Notify(job.CallbackURL, webhooks.Event{
+		Type:          webhooks.EventPaymentCompleted,
+		PaymentID:     job.PaymentID,
+		CorrelationID: job.CorrelationID,
+		Amount:        job.Amount,
+		Status:        models.PaymentStatusCompleted,
+		Fee:           &fee,
+		Processor:     string(processorType),
+		OccurredAt:    time.Now().UTC(),
+	})
+}
+
+// findCharge reports which processor, if any, already has the payment.
+func (wp *PaymentWorkerPool) findCharge(ctx context.Context, job PaymentJob) (processors.ProcessorType, bool) {
+	for _, processorType := range wp.processorService.Processors() {
+		found, err := wp.processorService.VerifyPayment(ctx, job.CorrelationID, processorType)
+		if err != nil {
+			slog.Error("failed to verify payment with processor", "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "processor", processorType, "error", err)
+			continue
+		}
+		if found {
+			return processorType, true
+		}
 	}
+	return "", false
+}
+
+// finishPayment records the payment as completed. latency is how long the
+// processors took to accept it, zero when it was found already charged.
+func (wp *PaymentWorkerPool) finishPayment(ctx context.Context, job PaymentJob, processorType processors.ProcessorType, workerID int, latency time.Duration) {
+	// The processor API doesn't return the fee, so apply its known rate
+	fee := job.Amount.MulRate(wp.processorService.FeeRate(processorType))
 
 	processorTypeStr := string(processorType)
-	if err := wp.dbService.CompletePayment(ctx, job.PaymentID, fee, processorTypeStr); err != nil {
-		log.Printf("Worker %d failed to complete payment %s: %v", workerID, job.PaymentID, err)
+	if err := wp.completePayment(ctx, job.PaymentID, fee, processorTypeStr, latency); err != nil {
+		slog.Error("failed to complete payment", "worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "error", err)
+		wp.compensator.add(job, fee, processorType, latency)
 		return
 	}
 
-	log.Printf("Worker %d successfully processed payment %s using %s processor (fee: %.2f)", 
-		workerID, job.PaymentID, processorType, fee)
-}
\ No newline at end of file
+	wp.written()
+	wp.slaTracker.Observe(time.Since(job.EnqueuedAt))
+	wp.processed.Add(1)
+	wp.recordEvent(ctx, job.PaymentID, models.PaymentStatusCompleted, workerActor(workerID), processorTypeStr, "")
+	wp.notifyCompleted(job, fee, processorType)
+
+	logging.HotPath("payment completed", "worker", workerID, "paymentId", job.PaymentID, "correlationId", job.CorrelationID, "processor", processorType, "fee", fee)
+}
+
+// OnPaymentWritten registers fn to be called each time a worker inserts or
+// completes a payment, e.g. to invalidate cached summaries. Call it before
+// Start.
+func (wp *PaymentWorkerPool) OnPaymentWritten(fn func()) {
+	wp.onWritten = fn
+}
+
+func (wp *PaymentWorkerPool) written() {
+	if wp.onWritten != nil {
+		wp.onWritten()
+	}
+}
+
+// SubmitReclaimed queues a payment taken over from a stale instance. Payments
+// that were already processing are verified against the processors first.
+// It returns ErrQueueFull instead of blocking when the retry queue has no
+// room.
+func (wp *PaymentWorkerPool) SubmitReclaimed(payment models.Payment) error {
+	job := newJob(payment)
+	job.VerifyFirst = payment.Status == models.PaymentStatusProcessing
+
+	wp.submitMutex.RLock()
+	defer wp.submitMutex.RUnlock()
+	if wp.stopping {
+		return ErrPoolStopped
+	}
+
+	select {
+	case wp.retryQueue <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// SLASnapshot returns the enqueue-to-completion latency percentiles for the
+// payments completed inside the rolling window.
+func (wp *PaymentWorkerPool) SLASnapshot() metrics.LatencySnapshot {
+	return wp.slaTracker.Snapshot()
+}
+
+// completePayment retries the local completion write a few times before giving
+// up, since at this point the processor has already charged the payment.
+func (wp *PaymentWorkerPool) completePayment(ctx context.Context, paymentID uuid.UUID, fee models.Money, processorType string, latency time.Duration) error {
+	var err error
+	for attempt := 0; attempt < completionImmediateRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * completionRetryDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err = wp.dbService.CompletePayment(ctx, paymentID, fee, processorType, latency)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, database.ErrPaymentAlreadyCompleted) {
+			slog.Warn("payment was already completed, keeping the first completion", "paymentId", paymentID, "processor", processorType)
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,251 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+)
+
+func TestSubmitPaymentCarriesRequestedAt(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 1, nil, nil)
+	requestedAt := time.Date(2025, 7, 15, 12, 34, 56, 0, time.UTC)
+
+	payment := models.Payment{ID: uuid.New(), CorrelationID: uuid.New(), Amount: 1990, RequestedAt: requestedAt}
+	if err := wp.SubmitPayment(payment); err != nil {
+		t.Fatalf("SubmitPayment() error = %v", err)
+	}
+
+	job := <-wp.jobQueue
+	if !job.RequestedAt.Equal(requestedAt) {
+		t.Errorf("expected job RequestedAt %v, got %v", requestedAt, job.RequestedAt)
+	}
+	if job.EnqueuedAt.IsZero() {
+		t.Error("expected job EnqueuedAt to be set")
+	}
+}
+
+func TestNextJobPrefersFreshPaymentsWithAging(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 4, nil, nil)
+	fresh := PaymentJob{PaymentID: uuid.New(), EnqueuedAt: time.Now()}
+	retry := PaymentJob{PaymentID: uuid.New(), EnqueuedAt: time.Now()}
+
+	wp.lastRetryServed.Store(time.Now().UnixNano())
+	wp.retryQueue <- retry
+	wp.jobQueue <- fresh
+
+	if job, _ := wp.nextJob(); job.PaymentID != fresh.PaymentID {
+		t.Fatal("expected the fresh payment to be served before the retry")
+	}
+	if job, _ := wp.nextJob(); job.PaymentID != retry.PaymentID {
+		t.Fatal("expected the retry once no fresh payment is waiting")
+	}
+
+	// A retry that has waited past retryAging jumps ahead of fresh traffic.
+	wp.lastRetryServed.Store(time.Now().Add(-2 * retryAging).UnixNano())
+	wp.jobQueue <- fresh
+	wp.retryQueue <- retry
+
+	if job, _ := wp.nextJob(); job.PaymentID != retry.PaymentID {
+		t.Fatal("expected the aged retry to be served first")
+	}
+}
+
+func TestNextJobIgnoresClosedQueue(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 1, nil, nil)
+	close(wp.jobQueue)
+
+	if _, ok := wp.nextJob(); ok {
+		t.Fatal("expected no job from a closed queue")
+	}
+	if last := wp.lastDequeued.Load(); last != 0 {
+		t.Errorf("expected nothing recorded as dequeued, got %d", last)
+	}
+}
+
+func TestPausedWorkerLeavesQueuedJobs(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 10, nil, nil)
+	wp.Pause()
+	wp.Start()
+	defer wp.Stop()
+
+	if err := wp.SubmitPayment(models.Payment{ID: uuid.New(), CorrelationID: uuid.New(), Amount: 100, RequestedAt: time.Now()}); err != nil {
+		t.Fatalf("SubmitPayment() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if wp.QueueLength() != 1 {
+		t.Fatalf("expected the job to stay queued while paused, queue length %d", wp.QueueLength())
+	}
+}
+
+func TestSetWorkersRetiresSurplusWorkers(t *testing.T) {
+	wp := NewPaymentWorkerPool(3, 10, nil, nil)
+	wp.Start()
+	defer wp.Stop()
+
+	running := func() int {
+		wp.workersMutex.RLock()
+		defer wp.workersMutex.RUnlock()
+		n := 0
+		for _, state := range wp.workerStates {
+			if state.running {
+				n++
+			}
+		}
+		return n
+	}
+
+	wp.SetWorkers(1)
+	deadline := time.Now().Add(time.Second)
+	for running() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := running(); got != 1 {
+		t.Fatalf("expected 1 running worker after shrinking, got %d", got)
+	}
+
+	wp.SetWorkers(4)
+	if got := running(); got != 4 {
+		t.Fatalf("expected 4 running workers after growing, got %d", got)
+	}
+	if got := len(wp.QueueStats().Workers); got != 4 {
+		t.Fatalf("expected stats for 4 workers, got %d", got)
+	}
+}
+
+func TestStopWaitsForJobsInFlight(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 1, nil, nil)
+	wp.shutdownGrace = time.Second
+	wp.Start()
+
+	// Stand in for a worker halfway through a payment
+	state := wp.state(0)
+	state.start(uuid.New())
+
+	stopped := make(chan struct{})
+	go func() {
+		wp.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("expected Stop to wait for the job in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	state.finish()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Stop to return once the job finished")
+	}
+}
+
+func TestSubmitAfterStopIsRejected(t *testing.T) {
+	wp := NewPaymentWorkerPool(1, 1, nil, nil)
+	wp.shutdownGrace = 0
+	wp.Start()
+	wp.Stop()
+
+	if err := wp.SubmitPayment(models.Payment{ID: uuid.New(), CorrelationID: uuid.New()}); !errors.Is(err, ErrPoolStopped) {
+		t.Fatalf("expected ErrPoolStopped, got %v", err)
+	}
+}
+
+// statusDB tracks the status of a single payment.
+type statusDB struct {
+	database.Service
+	status   models.PaymentStatus
+	statuses []models.PaymentStatus
+	reason   models.FailureReason
+}
+
+func (db *statusDB) UpdatePaymentStatus(_ context.Context, _ uuid.UUID, status models.PaymentStatus) error {
+	db.status = status
+	db.statuses = append(db.statuses, status)
+	return nil
+}
+
+func (db *statusDB) TransitionPaymentStatus(ctx context.Context, paymentID uuid.UUID, status models.PaymentStatus, from ...models.PaymentStatus) (bool, error) {
+	if !slices.Contains(from, db.status) {
+		return false, nil
+	}
+	return true, db.UpdatePaymentStatus(ctx, paymentID, status)
+}
+
+func (db *statusDB) FailPayment(ctx context.Context, paymentID uuid.UUID, reason models.FailureReason) error {
+	db.reason = reason
+	return db.UpdatePaymentStatus(ctx, paymentID, models.PaymentStatusFailed)
+}
+
+func (db *statusDB) ExpirePayment(ctx context.Context, paymentID uuid.UUID) (bool, error) {
+	expired, err := db.TransitionPaymentStatus(ctx, paymentID, models.PaymentStatusFailed, models.PaymentStatusPending)
+	if expired {
+		db.reason = models.FailureReasonExpired
+	}
+	return expired, err
+}
+
+func (db *statusDB) RecordPaymentEvent(context.Context, models.PaymentEvent) error {
+	return nil
+}
+
+func TestExpiredPendingJobIsFailedWithoutAttempt(t *testing.T) {
+	db := &statusDB{status: models.PaymentStatusPending}
+	// A nil processor service would panic if the job were attempted
+	wp := NewPaymentWorkerPool(1, 1, nil, db)
+	wp.pendingMaxAge = time.Minute
+
+	job := PaymentJob{PaymentID: uuid.New(), CorrelationID: uuid.New(), Amount: 100, RequestedAt: time.Now().Add(-2 * time.Minute)}
+	wp.processPayment(job, 0)
+
+	if len(db.statuses) != 1 || db.statuses[0] != models.PaymentStatusFailed {
+		t.Fatalf("expected the payment to go straight to failed, got %v", db.statuses)
+	}
+	if db.reason != models.FailureReasonExpired {
+		t.Errorf("expected failure reason %q, got %q", models.FailureReasonExpired, db.reason)
+	}
+	if stats := wp.QueueStats(); stats.ExpiredDropped != 1 {
+		t.Errorf("expected one expired job dropped, got %d", stats.ExpiredDropped)
+	}
+}
+
+func TestPaymentPastMaxJobAgeIsNotRedriven(t *testing.T) {
+	db := &statusDB{status: models.PaymentStatusPending}
+	wp := NewPaymentWorkerPool(1, 1, nil, db)
+	wp.maxJobAge = time.Minute
+
+	job := PaymentJob{PaymentID: uuid.New(), CorrelationID: uuid.New(), Amount: 100, RequestedAt: time.Now().Add(-2 * time.Minute)}
+	wp.processPayment(job, 0)
+
+	if db.status != models.PaymentStatusFailed || db.reason != models.FailureReasonMaxAge {
+		t.Fatalf("expected the payment failed with reason %q, got %s with %q", models.FailureReasonMaxAge, db.status, db.reason)
+	}
+}
+
+func TestJobForExpiredPaymentIsDropped(t *testing.T) {
+	// The sweeper expired the payment while its job was queued
+	db := &statusDB{status: models.PaymentStatusFailed}
+	wp := NewPaymentWorkerPool(1, 1, nil, db)
+
+	job := PaymentJob{PaymentID: uuid.New(), CorrelationID: uuid.New(), Amount: 100, RequestedAt: time.Now()}
+	wp.processPayment(job, 0)
+
+	wp.pendingMaxAge = time.Minute
+	job.RequestedAt = time.Now().Add(-2 * time.Minute)
+	wp.processPayment(job, 0)
+
+	if len(db.statuses) != 0 {
+		t.Fatalf("expected the expired payment left as it was, got %v", db.statuses)
+	}
+	if stats := wp.QueueStats(); stats.ExpiredDropped != 0 || stats.Workers[0].Failed != 0 {
+		t.Errorf("expected nothing counted for a payment already expired, got %d dropped and %d failed", stats.ExpiredDropped, stats.Workers[0].Failed)
+	}
+}
@@ -0,0 +1,85 @@
+package workers
+
+import (
+	"log/slog"
+)
+
+// SetWorkers changes the number of active workers. Extra workers are
+// started right away; surplus ones finish their current job and exit.
+func (wp *PaymentWorkerPool) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	wp.workersMutex.Lock()
+	previous := wp.activeWorkers
+	wp.resizeLocked(n)
+	if wp.started {
+		wp.startWorkersLocked()
+	}
+	wp.workersMutex.Unlock()
+
+	if n < previous {
+		// Idle workers are parked on the queue; wake them so the surplus
+		// ones notice they were retired.
+		wp.gate.wake()
+	}
+	if n != previous {
+		slog.Info("payment workers resized", "from", previous, "to", n)
+	}
+}
+
+func (wp *PaymentWorkerPool) resize(n int) {
+	wp.workersMutex.Lock()
+	defer wp.workersMutex.Unlock()
+	wp.resizeLocked(n)
+}
+
+func (wp *PaymentWorkerPool) resizeLocked(n int) {
+	for len(wp.workerStates) < n {
+		wp.workerStates = append(wp.workerStates, &workerState{})
+	}
+	wp.activeWorkers = n
+}
+
+// startWorkersLocked starts a goroutine for every active slot without one.
+func (wp *PaymentWorkerPool) startWorkersLocked() {
+	if wp.ctx.Err() != nil {
+		return
+	}
+	for i := 0; i < wp.activeWorkers; i++ {
+		state := wp.workerStates[i]
+		if state.running {
+			continue
+		}
+		state.running = true
+		wp.wg.Add(1)
+		go wp.worker(i)
+	}
+}
+
+// retire reports whether the worker is past the active count, releasing its
+// slot if so.
+func (wp *PaymentWorkerPool) retire(workerID int) bool {
+	wp.workersMutex.Lock()
+	defer wp.workersMutex.Unlock()
+	if workerID < wp.activeWorkers {
+		return false
+	}
+	wp.workerStates[workerID].running = false
+	return true
+}
+
+func (wp *PaymentWorkerPool) state(workerID int) *workerState {
+	wp.workersMutex.RLock()
+	defer wp.workersMutex.RUnlock()
+	return wp.workerStates[workerID]
+}
+
+// states returns every worker slot, retired ones included, along with the
+// active count.
+func (wp *PaymentWorkerPool) states() ([]*workerState, int) {
+	wp.workersMutex.RLock()
+	defer wp.workersMutex.RUnlock()
+	return wp.workerStates, wp.activeWorkers
+}
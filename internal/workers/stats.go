@@ -0,0 +1,187 @@
+package workers
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"rinha-backend-2025/internal/metrics"
+)
+
+// latencyBucketsMs are the upper bounds of the per-worker job latency
+// histogram; one more bucket counts everything slower.
+var latencyBucketsMs = [...]int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// workerState is updated by its worker goroutine and read by QueueStats.
+type workerState struct {
+	busySince  atomic.Int64 // unix nanos of the current job start, 0 when idle
+	currentJob atomic.Pointer[uuid.UUID]
+	processed  atomic.Uint64
+	failed     atomic.Uint64
+	latency    [len(latencyBucketsMs) + 1]atomic.Uint64
+
+	running bool // guarded by PaymentWorkerPool.workersMutex
+}
+
+func (s *workerState) start(paymentID uuid.UUID) {
+	s.currentJob.Store(&paymentID)
+	s.busySince.Store(time.Now().UnixNano())
+}
+
+func (s *workerState) finish() {
+	elapsed := time.Since(time.Unix(0, s.busySince.Load())).Milliseconds()
+	s.busySince.Store(0)
+	s.currentJob.Store(nil)
+	s.processed.Add(1)
+
+	bucket := len(latencyBucketsMs)
+	for i, upper := range latencyBucketsMs {
+		if elapsed <= upper {
+			bucket = i
+			break
+		}
+	}
+	s.latency[bucket].Add(1)
+}
+
+// LatencyBucket counts the jobs that took at most LeMs milliseconds ("+Inf"
+// for the last bucket). Counts are cumulative, as in a Prometheus histogram.
+type LatencyBucket struct {
+	LeMs  string `json:"leMs"`
+	Count uint64 `json:"count"`
+}
+
+type WorkerStats struct {
+	ID           int             `json:"id"`
+	Busy         bool            `json:"busy"`
+	BusyForMs    int64           `json:"busyForMs"`
+	CurrentJobID *uuid.UUID      `json:"currentJobId,omitempty"`
+	Processed    uint64          `json:"processed"`
+	Failed       uint64          `json:"failed"`
+	Latency      []LatencyBucket `json:"latency"`
+}
+
+type QueueStats struct {
+	QueueLength      int `json:"queueLength"`
+	QueueCapacity    int `json:"queueCapacity"`
+	RetryQueueLength int `json:"retryQueueLength"`
+	// RetryPending counts payments charged by a processor whose local
+	// completion is still being retried by the compensator.
+	RetryPending int `json:"retryPending"`
+	// OldestPendingAgeMs is an upper bound for the fresh queue: it is FIFO,
+	// so the job at its head was enqueued after the last job a worker took.
+	OldestPendingAgeMs int64 `json:"oldestPendingAgeMs"`
+	// StuckRecovered counts payments the sweeper found stuck in processing
+	// and queued again since startup.
+	StuckRecovered uint64 `json:"stuckRecovered"`
+	// Expired counts payments the sweeper failed for staying pending longer
+	// than PENDING_MAX_AGE. ExpiredDropped counts jobs workers dropped from
+	// the queue for the same reason; a payment expired by the sweeper while
+	// still queued counts in both.
+	Expired        uint64        `json:"expired"`
+	ExpiredDropped uint64        `json:"expiredDropped"`
+	Paused         bool          `json:"paused"`
+	Workers        []WorkerStats `json:"workers"`
+}
+
+// QueueStats returns a point-in-time view of the queue and every worker.
+func (wp *PaymentWorkerPool) QueueStats() QueueStats {
+	now := time.Now()
+	states, active := wp.states()
+	stats := QueueStats{
+		QueueLength:      len(wp.jobQueue),
+		QueueCapacity:    cap(wp.jobQueue),
+		RetryQueueLength: len(wp.retryQueue),
+		RetryPending:     wp.compensator.size(),
+		StuckRecovered:   wp.stuckRecovered.Load(),
+		Expired:          wp.expired.Load(),
+		ExpiredDropped:   wp.expiredDropped.Load(),
+		Paused:           wp.gate.paused(),
+		Workers:          make([]WorkerStats, active),
+	}
+
+	if stats.QueueLength > 0 {
+		if last := wp.lastDequeued.Load(); last > 0 {
+			stats.OldestPendingAgeMs = now.Sub(time.Unix(0, last)).Milliseconds()
+		}
+	}
+
+	for i, state := range states[:active] {
+		ws := WorkerStats{
+			ID:        i,
+			Processed: state.processed.Load(),
+			Failed:    state.failed.Load(),
+			Latency:   state.latencyBuckets(),
+		}
+		if since := state.busySince.Load(); since > 0 {
+			ws.Busy = true
+			ws.BusyForMs = now.Sub(time.Unix(0, since)).Milliseconds()
+			ws.CurrentJobID = state.currentJob.Load()
+		}
+		stats.Workers[i] = ws
+	}
+
+	return stats
+}
+
+func (s *workerState) latencyBuckets() []LatencyBucket {
+	buckets := make([]LatencyBucket, len(s.latency))
+	var total uint64
+	for i := range s.latency {
+		total += s.latency[i].Load()
+		buckets[i].Count = total
+		if i < len(latencyBucketsMs) {
+			buckets[i].LeMs = strconv.FormatInt(latencyBucketsMs[i], 10)
+		} else {
+			buckets[i].LeMs = "+Inf"
+		}
+	}
+	return buckets
+}
+
+// Idle reports whether no payment is queued, being processed or waiting for
+// its completion to be recorded.
+func (wp *PaymentWorkerPool) Idle() bool {
+	if len(wp.jobQueue) > 0 || len(wp.retryQueue) > 0 || wp.compensator.size() > 0 {
+		return false
+	}
+	states, _ := wp.states()
+	for _, state := range states {
+		if state.busySince.Load() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MinuteThroughput counts the payments accepted into the queue, completed
+// and marked failed during the minute starting at Minute.
+type MinuteThroughput struct {
+	Minute    time.Time `json:"minute"`
+	Accepted  int64     `json:"accepted"`
+	Processed int64     `json:"processed"`
+	Failed    int64     `json:"failed"`
+}
+
+// Throughput returns the recent per-minute counts, oldest first.
+func (wp *PaymentWorkerPool) Throughput() []MinuteThroughput {
+	accepted, processed, failed := wp.accepted.Buckets(), wp.processed.Buckets(), wp.failed.Buckets()
+
+	minutes := make([]MinuteThroughput, len(accepted))
+	for i := range minutes {
+		minutes[i] = MinuteThroughput{
+			Minute:    accepted[i].Start,
+			Accepted:  accepted[i].Count,
+			Processed: processed[i].Count,
+			Failed:    failed[i].Count,
+		}
+	}
+	return minutes
+}
+
+// QueueWait returns how long jobs waited in the queues before a worker took
+// them, over the last minute.
+func (wp *PaymentWorkerPool) QueueWait() metrics.LatencySnapshot {
+	return wp.queueWait.Snapshot()
+}
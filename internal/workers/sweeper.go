@@ -0,0 +1,107 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SweepStuck re-queues payments owned by owner that have been processing for
+// longer than stuckAfter without a worker or the compensator holding them.
+// They are verified against the processors before any new attempt.
+func (wp *PaymentWorkerPool) SweepStuck(ctx context.Context, owner string, stuckAfter time.Duration) (int, error) {
+	limit := cap(wp.retryQueue) - len(wp.retryQueue)
+	if limit == 0 {
+		return 0, nil
+	}
+
+	payments, err := wp.dbService.ClaimStuckPayments(ctx, owner, time.Now().Add(-stuckAfter), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, payment := range payments {
+		if wp.inFlight(payment.ID) {
+			continue
+		}
+
+		job := newJob(payment)
+		job.VerifyFirst = true
+
+		select {
+		case wp.retryQueue <- job:
+			recovered++
+		case <-ctx.Done():
+			wp.stuckRecovered.Add(uint64(recovered))
+			return recovered, ctx.Err()
+		}
+	}
+
+	wp.stuckRecovered.Add(uint64(recovered))
+	return recovered, nil
+}
+
+// expireBatch caps the payments one sweep expires.
+const expireBatch = 1000
+
+// SweepExpired marks failed the payments owned by owner still pending past
+// PENDING_MAX_AGE. Their jobs, if still queued, are failed again when a
+// worker takes them, without a processor attempt.
+func (wp *PaymentWorkerPool) SweepExpired(ctx context.Context, owner string) (int, error) {
+	if wp.pendingMaxAge <= 0 {
+		return 0, nil
+	}
+	n, err := wp.dbService.ExpirePendingPayments(ctx, owner, time.Now().Add(-wp.pendingMaxAge), expireBatch)
+	wp.expired.Add(uint64(n))
+	return n, err
+}
+
+// inFlight reports whether a worker or the compensator is still working on
+// the payment, in which case it is slow rather than stuck.
+func (wp *PaymentWorkerPool) inFlight(paymentID uuid.UUID) bool {
+	states, _ := wp.states()
+	for _, state := range states {
+		if current := state.currentJob.Load(); current != nil && *current == paymentID {
+			return true
+		}
+	}
+	return wp.compensator.has(paymentID)
+}
+
+// StartSweeper periodically re-queues stuck payments. It stops with the pool.
+func (wp *PaymentWorkerPool) StartSweeper(owner string, interval, stuckAfter time.Duration) {
+	wp.wg.Add(1)
+	go func() {
+		defer wp.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(wp.ctx, 10*time.Second)
+				n, err := wp.SweepStuck(ctx, owner, stuckAfter)
+				if err != nil {
+					slog.Error("failed to sweep stuck payments", "error", err)
+				} else if n > 0 {
+					slog.Warn("re-queued stuck payments", "count", n)
+				}
+				n, err = wp.SweepExpired(ctx, owner)
+				cancel()
+				if err != nil {
+					slog.Error("failed to expire pending payments", "error", err)
+				} else if n > 0 {
+					slog.Warn("expired pending payments", "count", n)
+				}
+			case <-wp.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	slog.Info("started stuck payment sweeper", "interval", interval, "stuckAfter", stuckAfter)
+}
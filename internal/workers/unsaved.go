@@ -0,0 +1,102 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"rinha-backend-2025/internal/database"
+	"rinha-backend-2025/internal/models"
+)
+
+const (
+	// unsavedRetryDelay spaces out inserts of a payment while the database
+	// is unreachable.
+	unsavedRetryDelay = 100 * time.Millisecond
+	// unsavedSaveTimeout bounds writing the queued unsaved payments on Stop.
+	unsavedSaveTimeout = 5 * time.Second
+)
+
+// SubmitUnsaved queues a payment that is not in the database yet; the worker
+// that takes it inserts it before processing. It lets the request path skip
+// the insert, at the cost of the payment only living in memory until then.
+func (wp *PaymentWorkerPool) SubmitUnsaved(payment models.Payment) error {
+	job := newJob(payment)
+	job.Unsaved = &payment
+	return wp.submit(job)
+}
+
+// insertUnsaved writes the payment of an unsaved job and fills in its ID. It
+// returns false when the job should not be processed: the correlationId was
+// already taken, or the insert failed and the job went back to the retry
+// queue.
+func (wp *PaymentWorkerPool) insertUnsaved(ctx context.Context, job *PaymentJob, logger *slog.Logger) bool {
+	err := wp.dbService.CreatePayment(ctx, job.Unsaved)
+	switch {
+	case err == nil:
+		wp.written()
+		job.PaymentID = job.Unsaved.ID
+		job.Unsaved = nil
+		return true
+	case errors.Is(err, database.ErrDuplicateCorrelationID):
+		logger.Info("payment with this correlationId already exists, dropping duplicate job")
+		return false
+	case !database.IsUnavailable(err):
+		logger.Error("database rejected payment, dropping job", "error", err)
+		return false
+	}
+
+	logger.Warn("failed to insert payment, retrying", "error", err)
+	select {
+	case <-time.After(unsavedRetryDelay):
+	case <-wp.ctx.Done():
+	}
+	select {
+	case wp.retryQueue <- *job:
+	default:
+		logger.Error("retry queue full, dropping unsaved payment", "amount", job.Amount)
+	}
+	return false
+}
+
+// saveUnsaved inserts the unsaved payments still queued when the pool stops,
+// so they stay pending in the database for the next instance to reclaim.
+func (wp *PaymentWorkerPool) saveUnsaved() {
+	ctx, cancel := context.WithTimeout(context.Background(), unsavedSaveTimeout)
+	defer cancel()
+
+	saved, lost := 0, 0
+	save := func(job PaymentJob) {
+		if job.Unsaved == nil {
+			return
+		}
+		if err := wp.dbService.CreatePayment(ctx, job.Unsaved); err != nil && !errors.Is(err, database.ErrDuplicateCorrelationID) {
+			slog.Error("failed to save queued payment on shutdown", "correlationId", job.CorrelationID, "error", err)
+			lost++
+			return
+		}
+		saved++
+	}
+
+	// jobQueue is closed by now; a nil channel stops the select from
+	// reading it once it is empty
+	jobQueue := wp.jobQueue
+	for {
+		select {
+		case job, ok := <-jobQueue:
+			if !ok {
+				jobQueue = nil
+				continue
+			}
+			save(job)
+		case job := <-wp.retryQueue:
+			save(job)
+		default:
+			if saved > 0 || lost > 0 {
+				slog.Info("saved queued payments on shutdown", "saved", saved, "lost", lost)
+			}
+			return
+		}
+	}
+}
@@ -2,9 +2,20 @@ CREATE TABLE IF NOT EXISTS payments (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     correlation_id UUID NOT NULL UNIQUE,
     amount DECIMAL(10,2) NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT 'BRL',
+    original_amount DECIMAL(10,2) NOT NULL,
+    tenant_id VARCHAR(64),
+    owner_instance VARCHAR(64),
+    callback_url VARCHAR(2048),
     fee DECIMAL(10,2),
     processor_type VARCHAR(20),
+    -- time from the first processor call to its acceptance, retries included
+    latency_ms INTEGER,
     status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    -- why a failed payment failed, see models.FailureReason
+    failure_reason VARCHAR(20),
+    -- times the DLQ re-drive moved it back to pending
+    redrive_count INTEGER NOT NULL DEFAULT 0,
     requested_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     processed_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
@@ -15,4 +26,25 @@ CREATE INDEX IF NOT EXISTS idx_payments_correlation_id ON payments(correlation_i
 CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
 CREATE INDEX IF NOT EXISTS idx_payments_requested_at ON payments(requested_at);
 CREATE INDEX IF NOT EXISTS idx_payments_processor_type ON payments(processor_type);
-CREATE INDEX IF NOT EXISTS idx_payments_processed_at ON payments(processed_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_payments_processed_at ON payments(processed_at);
+CREATE INDEX IF NOT EXISTS idx_payments_tenant_id ON payments(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_payments_owner_instance ON payments(owner_instance);
+
+-- Append-only trail of status transitions, read by GET /payments/:id/history
+CREATE TABLE IF NOT EXISTS payment_events (
+    id BIGSERIAL PRIMARY KEY,
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    actor VARCHAR(64) NOT NULL,
+    processor_type VARCHAR(20),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_payment_id ON payment_events(payment_id, id);
+
+CREATE TABLE IF NOT EXISTS instances (
+    id VARCHAR(64) PRIMARY KEY,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_heartbeat TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file